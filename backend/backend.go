@@ -0,0 +1,84 @@
+package backend
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTimeout is the time a single request may take
+const DefaultTimeout = 60 * time.Second
+
+// Backend is a translation engine
+// used by the paradox translator
+type Backend interface {
+	// Name identifies the backend in logs and localization markers
+	Name() string
+	// Capabilities describes what the backend supports
+	Capabilities() Capabilities
+	// Translate translates all texts of a request
+	// and returns the translations in the same order
+	Translate(ctx context.Context, request *Request) (*Response, error)
+	// Usage reports the character quota of the backend
+	Usage(ctx context.Context) (*Usage, error)
+}
+
+type Capabilities struct {
+	// TagHandling is set when content inside
+	// the ignored xml tags stays untouched
+	TagHandling bool
+	// Glossary is set when glossary ids are supported
+	Glossary bool
+	// MaxTexts is the maximum number of texts in one request
+	MaxTexts int
+	// MaxRequestSize is the maximum size of one request in bytes
+	MaxRequestSize int
+}
+
+type Language struct {
+	// Name of the language as used by paradox (e.g. english)
+	Name string
+	// Locale of the language (e.g. EN)
+	Locale string
+}
+
+type Request struct {
+	Texts          []string
+	SourceLanguage Language
+	TargetLanguage Language
+	IgnoreTags     []string
+	Glossary       string
+	// Terms is a local glossary of source terms and their translation
+	// for backends that can not use glossary ids
+	Terms map[string]string
+}
+
+type Response struct {
+	Translations []string
+	// Backend that translated the texts when
+	// it is not the backend that was called
+	Backend string
+}
+
+type Usage struct {
+	CharacterCount int
+	CharacterLimit int
+}
+
+// Limited is true when the backend has a character limit
+func (usage *Usage) Limited() bool {
+	return usage.CharacterLimit > 0
+}
+
+// Remaining returns the characters left before the limit is reached
+func (usage *Usage) Remaining() int {
+	return max(usage.CharacterLimit-usage.CharacterCount, 0)
+}
+
+// RequestContext derives the context of a single request.
+// A timeout of zero or less does not limit the request.
+func RequestContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"bahmut.de/pdx-deepl/logging"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const ChainName = "chain"
+
+// DefaultMaxFailures is how many requests in a row may fail
+// before a backend of a chain is treated as unavailable
+const DefaultMaxFailures = 3
+
+// Chain is a backend that uses its backends in order.
+// When the current backend runs out of quota, rejects the
+// credentials or keeps failing, the next backend takes over.
+type Chain struct {
+	Backends    []Backend
+	MaxFailures int
+
+	lock     sync.Mutex
+	current  int
+	failures int
+}
+
+func CreateChain(backends ...Backend) *Chain {
+	return &Chain{
+		Backends:    backends,
+		MaxFailures: DefaultMaxFailures,
+	}
+}
+
+func (chain *Chain) Name() string {
+	return ChainName
+}
+
+// Capabilities only promises what every backend of the
+// chain supports, since any of them may handle a request.
+// Glossary ids are passed to every backend that supports them.
+func (chain *Chain) Capabilities() Capabilities {
+	capabilities := Capabilities{TagHandling: true}
+	for i, backend := range chain.Backends {
+		current := backend.Capabilities()
+		capabilities.TagHandling = capabilities.TagHandling && current.TagHandling
+		capabilities.Glossary = capabilities.Glossary || current.Glossary
+		if i == 0 || current.MaxTexts < capabilities.MaxTexts {
+			capabilities.MaxTexts = current.MaxTexts
+		}
+		if i == 0 || current.MaxRequestSize < capabilities.MaxRequestSize {
+			capabilities.MaxRequestSize = current.MaxRequestSize
+		}
+	}
+	return capabilities
+}
+
+func (chain *Chain) Translate(ctx context.Context, request *Request) (*Response, error) {
+	for {
+		index, backend := chain.active()
+		if backend == nil {
+			return nil, fmt.Errorf("%w: all backends are exhausted", ErrQuotaExceeded)
+		}
+		response, err := backend.Translate(ctx, request)
+		if err == nil {
+			chain.succeeded(index)
+			if response.Backend == "" {
+				response.Backend = backend.Name()
+			}
+			return response, nil
+		}
+		if ctx.Err() != nil || !chain.failed(index, err) {
+			return nil, err
+		}
+	}
+}
+
+// Usage sums up the usage of all backends.
+// The chain is unlimited when one of its backends is.
+func (chain *Chain) Usage(ctx context.Context) (*Usage, error) {
+	total := &Usage{}
+	unlimited := false
+	for _, backend := range chain.Backends {
+		usage, err := backend.Usage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", backend.Name(), err)
+		}
+		if !usage.Limited() {
+			unlimited = true
+			continue
+		}
+		total.CharacterCount += usage.CharacterCount
+		total.CharacterLimit += usage.CharacterLimit
+	}
+	if unlimited {
+		return &Usage{}, nil
+	}
+	return total, nil
+}
+
+func (chain *Chain) active() (int, Backend) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	if chain.current >= len(chain.Backends) {
+		return chain.current, nil
+	}
+	return chain.current, chain.Backends[chain.current]
+}
+
+func (chain *Chain) succeeded(index int) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	if index == chain.current {
+		chain.failures = 0
+	}
+}
+
+// Records a failed request and returns true when
+// the chain moved on to the next backend
+func (chain *Chain) failed(index int, err error) bool {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	if index != chain.current {
+		// Another request already switched the backend
+		return true
+	}
+	if errors.Is(err, ErrTokenLost) || errors.Is(err, ErrPayloadTooLarge) {
+		// Caused by the texts and not by the backend
+		return false
+	}
+	exhausted := errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrAuthorization)
+	if !exhausted {
+		chain.failures++
+		if chain.failures < max(chain.MaxFailures, 1) {
+			return false
+		}
+	}
+	logging.Warnf("Backend %s is not available anymore: %s", chain.Backends[index].Name(), err)
+	chain.current++
+	chain.failures = 0
+	if chain.current < len(chain.Backends) {
+		logging.Warnf("Switching to backend %s", chain.Backends[chain.current].Name())
+	}
+	return true
+}
+
+// Names lists the names of the backends that may
+// translate a request, in the order they are used
+func Names(translationBackend Backend) []string {
+	chain, ok := translationBackend.(*Chain)
+	if !ok {
+		return []string{translationBackend.Name()}
+	}
+	names := make([]string, 0, len(chain.Backends))
+	for _, current := range chain.Backends {
+		names = append(names, Names(current)...)
+	}
+	return names
+}
@@ -0,0 +1,183 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// Backend for tests that fails with the queued errors
+// first and then translates every text. A nil error
+// in the queue is a request that succeeds.
+type fakeBackend struct {
+	name         string
+	errors       []error
+	capabilities Capabilities
+	usage        Usage
+	requests     int
+}
+
+func (fake *fakeBackend) Name() string {
+	return fake.name
+}
+
+func (fake *fakeBackend) Capabilities() Capabilities {
+	return fake.capabilities
+}
+
+func (fake *fakeBackend) Translate(ctx context.Context, request *Request) (*Response, error) {
+	fake.requests++
+	if len(fake.errors) > 0 {
+		err := fake.errors[0]
+		fake.errors = fake.errors[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	translations := make([]string, len(request.Texts))
+	for i, text := range request.Texts {
+		translations[i] = fake.name + ":" + text
+	}
+	return &Response{Translations: translations}, nil
+}
+
+func (fake *fakeBackend) Usage(ctx context.Context) (*Usage, error) {
+	return &fake.usage, nil
+}
+
+func translateTest(chain *Chain) (*Response, error) {
+	return chain.Translate(context.Background(), &Request{Texts: []string{"text"}})
+}
+
+func TestChainSwitchesWhenExhausted(t *testing.T) {
+	for _, err := range []error{ErrQuotaExceeded, ErrAuthorization} {
+		first := &fakeBackend{name: "first", errors: []error{err}}
+		second := &fakeBackend{name: "second"}
+		chain := CreateChain(first, second)
+
+		response, translateErr := translateTest(chain)
+		if translateErr != nil {
+			t.Fatal(translateErr)
+		}
+		if response.Backend != "second" || response.Translations[0] != "second:text" {
+			t.Errorf("%s: got %+v, want a translation of the second backend", err, response)
+		}
+		// The first backend is not asked again
+		_, _ = translateTest(chain)
+		if first.requests != 1 || second.requests != 2 {
+			t.Errorf("%s: sent %d and %d requests, want 1 and 2", err, first.requests, second.requests)
+		}
+	}
+}
+
+func TestChainSwitchesAfterFailuresInARow(t *testing.T) {
+	first := &fakeBackend{name: "first", errors: []error{ErrServer, ErrServer, nil, ErrServer, ErrServer, ErrServer}}
+	second := &fakeBackend{name: "second"}
+	chain := CreateChain(first, second)
+	chain.MaxFailures = 3
+
+	// Failures that are not in a row do not switch the backend
+	results := make([]string, 0)
+	for range 5 {
+		response, err := translateTest(chain)
+		if err != nil {
+			results = append(results, "error")
+			continue
+		}
+		results = append(results, response.Backend)
+	}
+	want := []string{"error", "error", "first", "error", "error"}
+	if !slices.Equal(results, want) {
+		t.Fatalf("got %v, want %v", results, want)
+	}
+
+	// The third failure in a row switches and the request is sent again
+	response, err := translateTest(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Backend != "second" || first.requests != 6 || second.requests != 1 {
+		t.Errorf("got backend %s after %d and %d requests", response.Backend, first.requests, second.requests)
+	}
+}
+
+func TestChainKeepsBackendForTextErrors(t *testing.T) {
+	for _, err := range []error{ErrTokenLost, ErrPayloadTooLarge} {
+		first := &fakeBackend{name: "first", errors: []error{err, err, err, err}}
+		second := &fakeBackend{name: "second"}
+		chain := CreateChain(first, second)
+		for range 4 {
+			_, translateErr := translateTest(chain)
+			if !errors.Is(translateErr, err) {
+				t.Errorf("got error %v, want %v", translateErr, err)
+			}
+		}
+		if second.requests != 0 {
+			t.Errorf("%s: switched to the second backend", err)
+		}
+	}
+}
+
+func TestChainExhausted(t *testing.T) {
+	chain := CreateChain(
+		&fakeBackend{name: "first", errors: []error{ErrQuotaExceeded}},
+		&fakeBackend{name: "second", errors: []error{ErrAuthorization}},
+	)
+	_, err := translateTest(chain)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("got error %v, want %v", err, ErrQuotaExceeded)
+	}
+}
+
+func TestChainCapabilitiesAndUsage(t *testing.T) {
+	chain := CreateChain(
+		&fakeBackend{
+			name:         "first",
+			capabilities: Capabilities{TagHandling: true, Glossary: true, MaxTexts: 50, MaxRequestSize: 1000},
+			usage:        Usage{CharacterCount: 10, CharacterLimit: 100},
+		},
+		&fakeBackend{
+			name:         "second",
+			capabilities: Capabilities{TagHandling: false, MaxTexts: 10, MaxRequestSize: 2000},
+			usage:        Usage{CharacterCount: 5, CharacterLimit: 50},
+		},
+	)
+	capabilities := chain.Capabilities()
+	want := Capabilities{TagHandling: false, Glossary: true, MaxTexts: 10, MaxRequestSize: 1000}
+	if capabilities != want {
+		t.Errorf("got %+v, want %+v", capabilities, want)
+	}
+	usage, err := chain.Usage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.CharacterCount != 15 || usage.CharacterLimit != 150 {
+		t.Errorf("got usage %+v, want 15 of 150", usage)
+	}
+
+	chain.Backends = append(chain.Backends, &fakeBackend{name: "unlimited"})
+	usage, err = chain.Usage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Limited() {
+		t.Errorf("got usage %+v, want unlimited", usage)
+	}
+	names := Names(CreateChain(chain, &fakeBackend{name: "last"}))
+	if !slices.Equal(names, []string{"first", "second", "unlimited", "last"}) {
+		t.Errorf("got names %v", names)
+	}
+}
+
+func TestChainFailedAfterSwitch(t *testing.T) {
+	chain := CreateChain(&fakeBackend{name: "first"}, &fakeBackend{name: "second"})
+	if !chain.failed(0, ErrQuotaExceeded) {
+		t.Fatal("exhausted backend was not switched")
+	}
+	// A request of the old backend that fails later is
+	// sent again and does not count against the new one
+	if !chain.failed(0, ErrServer) || chain.current != 1 || chain.failures != 0 {
+		t.Errorf("late failure changed the chain to backend %d with %d failures", chain.current, chain.failures)
+	}
+}
@@ -0,0 +1,34 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Errors shared by all backends so that the translator
+// can react to failures independent of the engine
+var (
+	ErrAuthorization   = errors.New("authorization failed")
+	ErrQuotaExceeded   = errors.New("quota exceeded")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrPayloadTooLarge = errors.New("payload too large")
+	ErrBadRequest      = errors.New("bad request")
+	ErrServer          = errors.New("server error")
+)
+
+// ErrorForStatus maps an http status code of a
+// failed request to one of the shared errors
+func ErrorForStatus(statusCode int) error {
+	switch {
+	case statusCode == http.StatusForbidden || statusCode == http.StatusUnauthorized:
+		return ErrAuthorization
+	case statusCode == http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	case statusCode == http.StatusRequestEntityTooLarge:
+		return ErrPayloadTooLarge
+	case statusCode >= 500:
+		return ErrServer
+	default:
+		return ErrBadRequest
+	}
+}
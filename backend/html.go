@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrTokenLost is returned when a protected token
+// did not survive the translation
+var ErrTokenLost = errors.New("protected token lost")
+
+var regexPlaceholder = regexp.MustCompile(`<span[^>]*\bid="p(\d+)"[^>]*>\s*</span>`)
+
+// EncodeHtml prepares an escaped localization for backends that
+// translate html. Every span inside one of the given tags is replaced by
+// an empty placeholder element so that its content can not be translated.
+// The replaced spans are returned and need to be passed to DecodeHtml.
+func EncodeHtml(text string, tags []string) (string, []string) {
+	expression := tagExpression(tags)
+	protected := make([]string, 0)
+	var builder strings.Builder
+	last := 0
+	for _, match := range expression.FindAllStringIndex(text, -1) {
+		builder.WriteString(html.EscapeString(text[last:match[0]]))
+		builder.WriteString(`<span translate="no" id="p`)
+		builder.WriteString(strconv.Itoa(len(protected)))
+		builder.WriteString(`"></span>`)
+		protected = append(protected, text[match[0]:match[1]])
+		last = match[1]
+	}
+	builder.WriteString(html.EscapeString(text[last:]))
+	return builder.String(), protected
+}
+
+// DecodeHtml reverts EncodeHtml on a translated text.
+// It fails with ErrTokenLost when a placeholder is missing.
+func DecodeHtml(text string, protected []string) (string, error) {
+	found := make([]bool, len(protected))
+	var builder strings.Builder
+	last := 0
+	for _, match := range regexPlaceholder.FindAllStringSubmatchIndex(text, -1) {
+		index, err := strconv.Atoi(text[match[2]:match[3]])
+		if err != nil || index >= len(protected) {
+			continue
+		}
+		builder.WriteString(html.UnescapeString(text[last:match[0]]))
+		builder.WriteString(protected[index])
+		found[index] = true
+		last = match[1]
+	}
+	builder.WriteString(html.UnescapeString(text[last:]))
+	for i, ok := range found {
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrTokenLost, protected[i])
+		}
+	}
+	return builder.String(), nil
+}
+
+func tagExpression(tags []string) *regexp.Regexp {
+	alternatives := make([]string, len(tags))
+	for i, tag := range tags {
+		quoted := regexp.QuoteMeta(tag)
+		alternatives[i] = "<" + quoted + ">.*?</" + quoted + ">"
+	}
+	if len(alternatives) == 0 {
+		// Matches nothing
+		return regexp.MustCompile(`$^`)
+	}
+	return regexp.MustCompile(strings.Join(alternatives, "|"))
+}
+
+// ProtectedTokens returns all spans inside one of the given tags
+func ProtectedTokens(text string, tags []string) []string {
+	return tagExpression(tags).FindAllString(text, -1)
+}
+
+// VerifyTokens checks that every protected token of the
+// source text is still present in the translation.
+// It fails with ErrTokenLost naming the first missing token.
+func VerifyTokens(source, translation string, tags []string) error {
+	remaining := translation
+	for _, token := range ProtectedTokens(source, tags) {
+		before, after, found := strings.Cut(remaining, token)
+		if !found {
+			return fmt.Errorf("%w: %s", ErrTokenLost, token)
+		}
+		remaining = before + after
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package backend
+
+import (
+	"bahmut.de/pdx-deepl/logging"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultMaxAttempts is how often a request is sent
+// before a transient failure is reported to the caller
+const DefaultMaxAttempts = 5
+
+const retryMaxDelay = 60 * time.Second
+
+// First delay of the exponential backoff
+var retryBaseDelay = 1 * time.Second
+
+// Send sends a json request to the api of a backend and returns the
+// response body. Transient failures are retried like in Retry.
+// A failed request returns one of the shared errors together
+// with the message that parseMessage finds in the body.
+func Send(
+	ctx context.Context,
+	timeout time.Duration,
+	maxAttempts int,
+	request *http.Request,
+	name string,
+	parseMessage func(body []byte) string,
+) ([]byte, error) {
+	return Retry(ctx, name, maxAttempts, func() ([]byte, time.Duration, error) {
+		return sendOnce(ctx, timeout, request, name, parseMessage)
+	})
+}
+
+// Retry calls send until it succeeds and retries transient failures
+// (network errors, 429, 503 and other 5xx responses)
+// with exponential backoff until maxAttempts is reached.
+// send returns a negative delay for permanent failures and zero
+// or the Retry-After delay of the api for transient failures.
+func Retry(ctx context.Context, name string, maxAttempts int, send func() ([]byte, time.Duration, error)) ([]byte, error) {
+	maxAttempts = max(maxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		body, retryAfter, err := send()
+		if err == nil {
+			return body, nil
+		}
+		if retryAfter < 0 || attempt >= maxAttempts || ctx.Err() != nil {
+			return nil, err
+		}
+		delay := retryAfter
+		if delay == 0 {
+			delay = backoff(attempt)
+		}
+		logging.Warnf(
+			"%s request failed (attempt %d/%d), retrying in %s: %s",
+			name, attempt, maxAttempts, delay.Round(time.Millisecond), err,
+		)
+		err = Sleep(ctx, delay)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Sends a single request. The request is
+// cloned so that it can be sent again.
+func sendOnce(
+	ctx context.Context,
+	timeout time.Duration,
+	request *http.Request,
+	name string,
+	parseMessage func(body []byte) string,
+) ([]byte, time.Duration, error) {
+	requestContext, cancel := RequestContext(ctx, timeout)
+	defer cancel()
+	request = request.Clone(requestContext)
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, -1, err
+		}
+		request.Body = body
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if response.StatusCode != 200 {
+		logging.Tracef("%s Response: %s", name, string(body))
+		statusError := NewStatusError(response, parseMessage(body))
+		if IsTransient(statusError) {
+			return nil, ParseRetryAfter(response.Header.Get("Retry-After")), statusError
+		}
+		return nil, -1, statusError
+	}
+
+	return body, 0, nil
+}
+
+// NewStatusError wraps the shared error of a failed response
+// with its status and the message of the api, if there is one
+func NewStatusError(response *http.Response, message string) error {
+	sentinel := ErrorForStatus(response.StatusCode)
+	if message != "" {
+		return fmt.Errorf("%w (%s): %s", sentinel, response.Status, message)
+	}
+	return fmt.Errorf("%w (%s)", sentinel, response.Status)
+}
+
+// IsTransient reports whether a request that failed
+// with this error may succeed when it is sent again
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrTooManyRequests) || errors.Is(err, ErrServer)
+}
+
+// ParseRetryAfter parses the Retry-After header
+// which is either a number of seconds or an http date
+func ParseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return min(time.Duration(seconds)*time.Second, retryMaxDelay)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay > 0 {
+			return min(delay, retryMaxDelay)
+		}
+	}
+	return 0
+}
+
+// Exponential backoff with jitter in the upper half of the delay
+func backoff(attempt int) time.Duration {
+	ceiling := retryBaseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > retryMaxDelay {
+		ceiling = retryMaxDelay
+	}
+	return ceiling/2 + rand.N(ceiling/2+1)
+}
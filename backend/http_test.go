@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func errorMessage(body []byte) string {
+	return strings.TrimSpace(string(body))
+}
+
+func TestSendRetriesTransientFailures(t *testing.T) {
+	retryBaseDelay = time.Millisecond
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "hello" {
+			t.Errorf("attempt %d sent body %q", count, body)
+		}
+		if count < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("POST", server.URL, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := Send(context.Background(), time.Second, 3, request, "Test", errorMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok" || requests.Load() != 3 {
+		t.Errorf("got %q after %d requests, want ok after 3", body, requests.Load())
+	}
+}
+
+func TestSendReportsFailures(t *testing.T) {
+	retryBaseDelay = time.Millisecond
+	tests := []struct {
+		name     string
+		status   int
+		attempts int
+		err      error
+	}{
+		{name: "bad request", status: http.StatusBadRequest, attempts: 1, err: ErrBadRequest},
+		{name: "forbidden", status: http.StatusForbidden, attempts: 1, err: ErrAuthorization},
+		{name: "too large", status: http.StatusRequestEntityTooLarge, attempts: 1, err: ErrPayloadTooLarge},
+		{name: "too many requests", status: http.StatusTooManyRequests, attempts: 2, err: ErrTooManyRequests},
+		{name: "server error", status: http.StatusInternalServerError, attempts: 2, err: ErrServer},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(test.status)
+				w.Write([]byte("details"))
+			}))
+			defer server.Close()
+
+			request, err := http.NewRequest("GET", server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = Send(context.Background(), time.Second, 2, request, "Test", errorMessage)
+			if !errors.Is(err, test.err) {
+				t.Errorf("got error %v, want %v", err, test.err)
+			}
+			if err != nil && !strings.HasSuffix(err.Error(), ": details") {
+				t.Errorf("error %q does not contain the message", err)
+			}
+			if int(requests.Load()) != test.attempts {
+				t.Errorf("sent %d requests, want %d", requests.Load(), test.attempts)
+			}
+		})
+	}
+}
+
+func TestSendRetriesTimeouts(t *testing.T) {
+	retryBaseDelay = time.Millisecond
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := requests.Add(1)
+		if count == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := Send(context.Background(), 50*time.Millisecond, 2, request, "Test", errorMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok" || requests.Load() != 2 {
+		t.Errorf("got %q after %d requests, want ok after 2", body, requests.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "missing", value: "", max: 0},
+		{name: "seconds", value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{name: "capped", value: "3600", min: retryMaxDelay, max: retryMaxDelay},
+		{name: "invalid", value: "soon", max: 0},
+		{name: "negative", value: "-5", max: 0},
+		{name: "date", value: time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), min: 8 * time.Second, max: 10 * time.Second},
+		{name: "past date", value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), max: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delay := ParseRetryAfter(test.value)
+			if delay < test.min || delay > test.max {
+				t.Errorf("got %s, want between %s and %s", delay, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	retryBaseDelay = time.Second
+	for attempt, ceiling := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: retryMaxDelay, 100: retryMaxDelay} {
+		delay := backoff(attempt)
+		if delay < ceiling/2 || delay > ceiling {
+			t.Errorf("attempt %d waits %s, want between %s and %s", attempt, delay, ceiling/2, ceiling)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package backend
+
+import (
+	"bahmut.de/pdx-deepl/logging"
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits of the adaptive slow down
+const (
+	minRateFactor      = 1.0 / 8
+	recoverySuccesses  = 20
+	recoveryMultiplier = 1.25
+)
+
+// RateLimiter is a token bucket limiter for requests and characters.
+// When the api reports too many requests, the rates are halved and slowly
+// raised back to the configured rates after a run of successful requests.
+// A nil RateLimiter does not limit anything.
+type RateLimiter struct {
+	RequestsPerSecond   float64
+	CharactersPerMinute float64
+
+	lock            sync.Mutex
+	factor          float64
+	successes       int
+	requestTokens   float64
+	characterTokens float64
+	last            time.Time
+}
+
+// CreateRateLimiter creates a limiter with the given rates.
+// A rate of zero or less is not limited.
+func CreateRateLimiter(requestsPerSecond float64, charactersPerMinute int) *RateLimiter {
+	limiter := &RateLimiter{
+		RequestsPerSecond:   requestsPerSecond,
+		CharactersPerMinute: float64(charactersPerMinute),
+		factor:              1,
+		last:                time.Now(),
+	}
+	limiter.requestTokens = limiter.requestCapacity()
+	limiter.characterTokens = limiter.characterCapacity()
+	return limiter
+}
+
+// Wait blocks until a request with the given amount of characters
+// may be sent or the context is done
+func (limiter *RateLimiter) Wait(ctx context.Context, characters int) error {
+	if limiter == nil {
+		return ctx.Err()
+	}
+	for {
+		delay := limiter.reserve(float64(characters))
+		if delay <= 0 {
+			return ctx.Err()
+		}
+		err := Sleep(ctx, delay)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Throttle halves the rates after the api reported too many requests
+func (limiter *RateLimiter) Throttle() {
+	if limiter == nil {
+		return
+	}
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	limiter.successes = 0
+	if limiter.factor > minRateFactor {
+		limiter.factor = max(limiter.factor/2, minRateFactor)
+		logging.Debugf("Slowing down requests to %.0f%% of the configured rate", limiter.factor*100)
+	}
+}
+
+// Succeeded raises throttled rates again after enough successful requests
+func (limiter *RateLimiter) Succeeded() {
+	if limiter == nil {
+		return
+	}
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	if limiter.factor >= 1 {
+		return
+	}
+	limiter.successes++
+	if limiter.successes >= recoverySuccesses {
+		limiter.successes = 0
+		limiter.factor = min(limiter.factor*recoveryMultiplier, 1)
+		logging.Debugf("Speeding up requests to %.0f%% of the configured rate", limiter.factor*100)
+	}
+}
+
+// Takes tokens for one request when available
+// and otherwise returns how long to wait
+func (limiter *RateLimiter) reserve(characters float64) time.Duration {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(limiter.last).Seconds()
+	limiter.last = now
+
+	requestRate := limiter.RequestsPerSecond * limiter.factor
+	characterRate := limiter.CharactersPerMinute / 60 * limiter.factor
+
+	var delay time.Duration
+	if requestRate > 0 {
+		limiter.requestTokens = min(limiter.requestTokens+elapsed*requestRate, limiter.requestCapacity())
+		if limiter.requestTokens < 1 {
+			delay = max(delay, seconds((1-limiter.requestTokens)/requestRate))
+		}
+	}
+	if characterRate > 0 {
+		// Texts larger than the bucket are sent once it is full
+		needed := min(characters, limiter.characterCapacity())
+		limiter.characterTokens = min(limiter.characterTokens+elapsed*characterRate, limiter.characterCapacity())
+		if limiter.characterTokens < needed {
+			delay = max(delay, seconds((needed-limiter.characterTokens)/characterRate))
+		}
+	}
+	if delay > 0 {
+		return delay
+	}
+
+	if requestRate > 0 {
+		limiter.requestTokens--
+	}
+	if characterRate > 0 {
+		limiter.characterTokens -= characters
+	}
+	return 0
+}
+
+// Requests that may be sent at once
+func (limiter *RateLimiter) requestCapacity() float64 {
+	return max(limiter.RequestsPerSecond, 1)
+}
+
+// Characters that may be sent at once
+func (limiter *RateLimiter) characterCapacity() float64 {
+	return limiter.CharactersPerMinute / 6
+}
+
+// Sleep waits for the given duration and
+// returns early when the context is done
+func Sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
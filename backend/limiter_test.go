@@ -0,0 +1,117 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Whether the delay is the expected one with some
+// tolerance for the time that passed while testing
+func near(delay, want time.Duration) bool {
+	return delay > want-50*time.Millisecond && delay <= want
+}
+
+func TestLimiterRequests(t *testing.T) {
+	limiter := CreateRateLimiter(2, 0)
+	for i := range 2 {
+		if delay := limiter.reserve(100); delay != 0 {
+			t.Fatalf("request %d waits %s, want a full bucket", i, delay)
+		}
+	}
+	if delay := limiter.reserve(100); !near(delay, 500*time.Millisecond) {
+		t.Errorf("request waits %s, want 500ms", delay)
+	}
+}
+
+func TestLimiterCharacters(t *testing.T) {
+	// 10 characters per second with a bucket of 100
+	limiter := CreateRateLimiter(0, 600)
+	if delay := limiter.reserve(100); delay != 0 {
+		t.Fatalf("request waits %s, want a full bucket", delay)
+	}
+	if delay := limiter.reserve(50); !near(delay, 5*time.Second) {
+		t.Errorf("request waits %s, want 5s", delay)
+	}
+	// Texts larger than the bucket wait until it is full
+	if delay := limiter.reserve(1000); !near(delay, 10*time.Second) {
+		t.Errorf("large request waits %s, want 10s", delay)
+	}
+}
+
+func TestLimiterThrottleAndRecovery(t *testing.T) {
+	limiter := CreateRateLimiter(2, 0)
+	limiter.reserve(0)
+	limiter.reserve(0)
+
+	limiter.Throttle()
+	if limiter.factor != 0.5 {
+		t.Fatalf("factor is %v after throttling, want 0.5", limiter.factor)
+	}
+	if delay := limiter.reserve(0); !near(delay, time.Second) {
+		t.Errorf("throttled request waits %s, want 1s", delay)
+	}
+	for range 10 {
+		limiter.Throttle()
+	}
+	if limiter.factor != minRateFactor {
+		t.Errorf("factor is %v, want the minimum %v", limiter.factor, minRateFactor)
+	}
+
+	for range recoverySuccesses - 1 {
+		limiter.Succeeded()
+	}
+	if limiter.factor != minRateFactor {
+		t.Errorf("recovered after %d successes, want %d", recoverySuccesses-1, recoverySuccesses)
+	}
+	limiter.Succeeded()
+	if limiter.factor != minRateFactor*recoveryMultiplier {
+		t.Errorf("factor is %v, want %v", limiter.factor, minRateFactor*recoveryMultiplier)
+	}
+
+	// A throttle in between starts the recovery again
+	for range recoverySuccesses - 1 {
+		limiter.Succeeded()
+	}
+	limiter.Throttle()
+	for range recoverySuccesses - 1 {
+		limiter.Succeeded()
+	}
+	if limiter.factor != minRateFactor {
+		t.Errorf("factor is %v, want %v", limiter.factor, minRateFactor)
+	}
+
+	for range 1000 {
+		limiter.Succeeded()
+	}
+	if limiter.factor != 1 {
+		t.Errorf("factor is %v after recovering, want at most the configured rate", limiter.factor)
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	var limiter *RateLimiter
+	if err := limiter.Wait(context.Background(), 100); err != nil {
+		t.Errorf("nil limiter returned %v", err)
+	}
+	limiter.Throttle()
+	limiter.Succeeded()
+
+	limiter = CreateRateLimiter(0, 0)
+	for range 100 {
+		if delay := limiter.reserve(1000); delay != 0 {
+			t.Fatalf("unlimited request waits %s", delay)
+		}
+	}
+
+	limiter = CreateRateLimiter(1, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Wait(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the wait to end with the context", err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bahmut.de/pdx-deepl/backend"
+	"bahmut.de/pdx-deepl/deepl"
+	"bahmut.de/pdx-deepl/google"
+	"bahmut.de/pdx-deepl/libretranslate"
+	"bahmut.de/pdx-deepl/logging"
+	"bahmut.de/pdx-deepl/openai"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ApiDeepl          = "deepl"
+	ApiFree           = "free"
+	ApiPaid           = "paid"
+	ApiLibreTranslate = "libretranslate"
+	ApiOpenAi         = "openai"
+	ApiGoogle         = "google"
+)
+
+var ApiTypes = []string{ApiDeepl, ApiFree, ApiPaid, ApiLibreTranslate, ApiOpenAi, ApiGoogle}
+
+// BackendSettings contains everything
+// needed to create a translation backend
+type BackendSettings struct {
+	Type        string
+	Url         string
+	Token       string
+	Model       string
+	Prompt      string
+	MaxAttempts int
+	Timeout     time.Duration
+	// Rates of the DeepL rate limiter
+	RequestsPerSecond   float64
+	CharactersPerMinute int
+}
+
+// Whether the api type can not be used without a token
+func requiresToken(apiType string) bool {
+	return apiType == ApiDeepl || apiType == ApiFree || apiType == ApiPaid || apiType == ApiGoogle
+}
+
+func createBackend(ctx context.Context, settings *BackendSettings) (backend.Backend, error) {
+	if requiresToken(settings.Type) && settings.Token == "" {
+		return nil, fmt.Errorf("an api token is required for %s", settings.Type)
+	}
+
+	switch settings.Type {
+	case ApiDeepl, ApiFree, ApiPaid:
+		return createDeeplBackend(ctx, settings)
+	case ApiLibreTranslate:
+		apiUrl, err := resolveApiUrl(settings.Url, "")
+		if err != nil {
+			return nil, err
+		}
+		api := libretranslate.CreateApi(apiUrl, settings.Token)
+		api.Timeout = settings.Timeout
+		if settings.MaxAttempts > 0 {
+			api.MaxAttempts = settings.MaxAttempts
+		}
+		return api, nil
+	case ApiGoogle:
+		apiUrl, err := resolveApiUrl(settings.Url, google.DefaultApiUrl)
+		if err != nil {
+			return nil, err
+		}
+		api := google.CreateApi(apiUrl, settings.Token)
+		api.Timeout = settings.Timeout
+		if settings.MaxAttempts > 0 {
+			api.MaxAttempts = settings.MaxAttempts
+		}
+		return api, nil
+	case ApiOpenAi:
+		apiUrl, err := resolveApiUrl(settings.Url, "")
+		if err != nil {
+			return nil, err
+		}
+		if settings.Model == "" {
+			return nil, fmt.Errorf("a model is required for %s", ApiOpenAi)
+		}
+		logging.Infof("%sModel:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, settings.Model)
+		api := openai.CreateApi(apiUrl, settings.Token, settings.Model)
+		api.Timeout = settings.Timeout
+		if settings.MaxAttempts > 0 {
+			api.MaxAttempts = settings.MaxAttempts
+		}
+		if settings.Prompt != "" {
+			err = api.LoadPrompt(settings.Prompt)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return api, nil
+	default:
+		return nil, fmt.Errorf("api type %s unknown please choose one of %v", settings.Type, ApiTypes)
+	}
+}
+
+// Creates a DeepL backend for one or more comma separated tokens.
+// Every token may be prefixed with its api type (e.g. "paid:token"),
+// otherwise the type of the settings is used. For the deepl type
+// free keys are detected by their ":fx" suffix.
+func createDeeplBackend(ctx context.Context, settings *BackendSettings) (backend.Backend, error) {
+	apis := make([]*deepl.Api, 0)
+	// All keys share one limiter
+	limiter := backend.CreateRateLimiter(settings.RequestsPerSecond, settings.CharactersPerMinute)
+	for _, token := range strings.Split(settings.Token, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		apiType := settings.Type
+		for _, prefix := range []string{ApiFree, ApiPaid} {
+			if trimmed, found := strings.CutPrefix(token, prefix+":"); found {
+				apiType = prefix
+				token = trimmed
+			}
+		}
+
+		if apiType == ApiDeepl {
+			apiType = ApiPaid
+			if deepl.IsFreeToken(token) {
+				apiType = ApiFree
+			}
+			logging.Infof("%sDetected API Type:%s %s (%s)", logging.AnsiBoldOn, logging.AnsiAllDefault, apiType, deepl.MaskToken(token))
+		}
+
+		fallback := deepl.ApiUrlFree
+		if apiType == ApiPaid {
+			fallback = deepl.ApiUrlPaid
+		}
+		apiUrl, err := resolveApiUrl(settings.Url, fallback)
+		if err != nil {
+			return nil, err
+		}
+
+		api := deepl.CreateApi(apiUrl, token)
+		api.Limiter = limiter
+		api.Timeout = settings.Timeout
+		if settings.MaxAttempts > 0 {
+			api.MaxAttempts = settings.MaxAttempts
+		}
+		apis = append(apis, api)
+	}
+	if len(apis) == 0 {
+		return nil, fmt.Errorf("an api token is required for %s", settings.Type)
+	}
+
+	deeplBackend := deepl.CreateBackend(apis...)
+	if len(apis) > 1 {
+		err := deeplBackend.Rank(ctx)
+		if err != nil {
+			return nil, err
+		}
+		logging.Infof("%sAPI Keys:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, len(deeplBackend.Apis))
+	}
+	return deeplBackend, nil
+}
+
+// Parses the configured url or falls back to the default
+// url of the api. An empty default means the url is required.
+func resolveApiUrl(configured, fallback string) (*url.URL, error) {
+	resolved := configured
+	if resolved == "" {
+		resolved = fallback
+	}
+	if resolved == "" {
+		return nil, fmt.Errorf("an api url is required")
+	}
+	apiUrl, err := url.Parse(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse api url: %s", err)
+	}
+	if configured != "" {
+		logging.Infof("%sAPI URL:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, apiUrl)
+	}
+	return apiUrl, nil
+}
@@ -0,0 +1,144 @@
+package deepl
+
+import (
+	"bahmut.de/pdx-deepl/backend"
+	"bahmut.de/pdx-deepl/logging"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const BackendName = "deepl"
+
+// Backend makes the DeepL api available to the translator.
+// It can use several api keys and switches to the
+// next key when the quota of the current one is exhausted.
+type Backend struct {
+	Apis []*Api
+
+	lock    sync.Mutex
+	current int
+}
+
+func CreateBackend(apis ...*Api) *Backend {
+	return &Backend{
+		Apis: apis,
+	}
+}
+
+func (deepl *Backend) Name() string {
+	return BackendName
+}
+
+func (deepl *Backend) Capabilities() backend.Capabilities {
+	return backend.Capabilities{
+		TagHandling:    true,
+		Glossary:       true,
+		MaxTexts:       MaxTexts,
+		MaxRequestSize: MaxRequestSize,
+	}
+}
+
+func (deepl *Backend) Translate(ctx context.Context, request *backend.Request) (*backend.Response, error) {
+	for {
+		index, api := deepl.active()
+		if api == nil {
+			return nil, fmt.Errorf("%w: all api keys are exhausted", ErrQuotaExceeded)
+		}
+		response, err := api.Translate(
+			ctx,
+			request.Texts,
+			request.SourceLanguage.Locale,
+			request.TargetLanguage.Locale,
+			request.IgnoreTags,
+			request.Glossary,
+		)
+		if err != nil {
+			if errors.Is(err, ErrQuotaExceeded) && deepl.rotate(index, err) {
+				continue
+			}
+			return nil, err
+		}
+		translations := make([]string, len(response.Translations))
+		for i, translation := range response.Translations {
+			translations[i] = translation.Translation
+		}
+		return &backend.Response{Translations: translations}, nil
+	}
+}
+
+// Usage sums up the usage of all api keys
+func (deepl *Backend) Usage(ctx context.Context) (*backend.Usage, error) {
+	total := &backend.Usage{}
+	for _, api := range deepl.Apis {
+		response, err := api.Usage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("api key %s: %w", api.MaskedToken(), err)
+		}
+		total.CharacterCount += response.CharacterCount
+		total.CharacterLimit += response.CharacterLimit
+	}
+	return total, nil
+}
+
+// Rank checks the usage of every api key and orders them so that the key
+// with the most remaining characters is used first.
+// Keys that are rejected by DeepL are removed.
+func (deepl *Backend) Rank(ctx context.Context) error {
+	deepl.lock.Lock()
+	defer deepl.lock.Unlock()
+
+	remaining := make(map[*Api]int)
+	valid := make([]*Api, 0, len(deepl.Apis))
+	var lastError error
+	for _, api := range deepl.Apis {
+		response, err := api.Usage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			logging.Warnf("Ignoring api key %s: %s", api.MaskedToken(), err)
+			lastError = err
+			continue
+		}
+		remaining[api] = response.CharacterLimit - response.CharacterCount
+		valid = append(valid, api)
+		logging.Debugf("Api key %s has %d characters left", api.MaskedToken(), remaining[api])
+	}
+	if len(valid) == 0 {
+		return lastError
+	}
+
+	sort.SliceStable(valid, func(i, j int) bool {
+		return remaining[valid[i]] > remaining[valid[j]]
+	})
+	deepl.Apis = valid
+	deepl.current = 0
+	return nil
+}
+
+func (deepl *Backend) active() (int, *Api) {
+	deepl.lock.Lock()
+	defer deepl.lock.Unlock()
+	if deepl.current >= len(deepl.Apis) {
+		return deepl.current, nil
+	}
+	return deepl.current, deepl.Apis[deepl.current]
+}
+
+// Switches to the next api key and returns
+// true when there is one left to try
+func (deepl *Backend) rotate(index int, err error) bool {
+	deepl.lock.Lock()
+	defer deepl.lock.Unlock()
+	if index == deepl.current {
+		logging.Warnf("Api key %s is exhausted: %s", deepl.Apis[index].MaskedToken(), err)
+		deepl.current++
+		if deepl.current < len(deepl.Apis) {
+			logging.Infof("Switching to api key %s", deepl.Apis[deepl.current].MaskedToken())
+		}
+	}
+	return deepl.current < len(deepl.Apis)
+}
@@ -0,0 +1,131 @@
+package deepl
+
+import (
+	"bahmut.de/pdx-deepl/backend"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Stub api key with its remaining characters.
+// A negative limit rejects the key.
+type testKey struct {
+	token     string
+	count     int
+	limit     int
+	exhausted atomic.Bool
+	requests  atomic.Int32
+}
+
+// Creates a backend with an api for every key. All apis use one
+// stub server that answers for the key of the Authorization header.
+func createTestBackend(t *testing.T, keys ...*testKey) *Backend {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "DeepL-Auth-Key ")
+		index := slices.IndexFunc(keys, func(key *testKey) bool { return key.token == token })
+		key := keys[index]
+		key.requests.Add(1)
+		switch {
+		case key.limit < 0:
+			w.WriteHeader(http.StatusForbidden)
+		case strings.HasSuffix(r.URL.Path, EndpointUsage):
+			fmt.Fprintf(w, `{"character_count":%d,"character_limit":%d}`, key.count, key.limit)
+		case key.exhausted.Load():
+			w.WriteHeader(StatusQuotaExceeded)
+		default:
+			fmt.Fprintf(w, `{"translations":[{"text":"%s"}]}`, key.token)
+		}
+	}
+	apis := make([]*Api, 0, len(keys))
+	apiUrl := createTestApi(t, handler).ApiUrl
+	for _, key := range keys {
+		api := CreateApi(apiUrl, key.token)
+		api.Limiter = nil
+		apis = append(apis, api)
+	}
+	return CreateBackend(apis...)
+}
+
+func translateTest(deepl *Backend) (*backend.Response, error) {
+	return deepl.Translate(context.Background(), &backend.Request{Texts: []string{"text"}})
+}
+
+func tokens(deepl *Backend) []string {
+	result := make([]string, 0, len(deepl.Apis))
+	for _, api := range deepl.Apis {
+		result = append(result, api.Token)
+	}
+	return result
+}
+
+func TestRank(t *testing.T) {
+	deepl := createTestBackend(t,
+		&testKey{token: "low", count: 90, limit: 100},
+		&testKey{token: "rejected", limit: -1},
+		&testKey{token: "high", count: 0, limit: 100},
+		&testKey{token: "middle", count: 50, limit: 100},
+	)
+	err := deepl.Rank(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tokens(deepl); !slices.Equal(got, []string{"high", "middle", "low"}) {
+		t.Errorf("got keys %v, want high, middle, low", got)
+	}
+
+	deepl = createTestBackend(t, &testKey{token: "a", limit: -1}, &testKey{token: "b", limit: -1})
+	err = deepl.Rank(context.Background())
+	if !errors.Is(err, ErrAuthorization) {
+		t.Errorf("got error %v, want %v", err, ErrAuthorization)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	first := &testKey{token: "first"}
+	first.exhausted.Store(true)
+	second := &testKey{token: "second"}
+	deepl := createTestBackend(t, first, second)
+
+	response, err := translateTest(deepl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Translations[0] != "second" {
+		t.Errorf("got translation of %s, want second", response.Translations[0])
+	}
+	// The exhausted key is not used again
+	_, err = translateTest(deepl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.requests.Load() != 1 || second.requests.Load() != 2 {
+		t.Errorf("sent %d and %d requests, want 1 and 2", first.requests.Load(), second.requests.Load())
+	}
+
+	second.exhausted.Store(true)
+	_, err = translateTest(deepl)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("got error %v, want %v", err, ErrQuotaExceeded)
+	}
+	_, err = translateTest(deepl)
+	if !errors.Is(err, ErrQuotaExceeded) || second.requests.Load() != 3 {
+		t.Errorf("got error %v after %d requests, want no request once all keys are exhausted", err, second.requests.Load())
+	}
+}
+
+func TestRotateAfterSwitch(t *testing.T) {
+	deepl := createTestBackend(t, &testKey{token: "a"}, &testKey{token: "b"}, &testKey{token: "c"})
+	if !deepl.rotate(0, ErrQuotaExceeded) || deepl.current != 1 {
+		t.Fatalf("rotated to key %d, want 1", deepl.current)
+	}
+	// A request with the old key that fails later
+	// does not skip the key that took over
+	if !deepl.rotate(0, ErrQuotaExceeded) || deepl.current != 1 {
+		t.Errorf("rotated to key %d, want 1", deepl.current)
+	}
+}
@@ -1,18 +1,41 @@
 package deepl
 
 import (
+	"bahmut.de/pdx-deepl/backend"
 	"bahmut.de/pdx-deepl/logging"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+const ApiUrlFree = "https://api-free.deepl.com/v2/"
+const ApiUrlPaid = "https://api.deepl.com/v2/"
+
+// freeTokenSuffix is the suffix of every free api key
+const freeTokenSuffix = ":fx"
+
 const EndpointTranslate = "translate"
 const EndpointUsage = "usage"
 
+// MaxTexts is the maximum number of texts
+// DeepL accepts in a single translate request
+const MaxTexts = 50
+
+// MaxRequestSize is the maximum size in bytes
+// of a translate request body DeepL accepts
+const MaxRequestSize = 128 * 1024
+
+// DefaultRequestsPerSecond is the request rate used
+// unless another one is configured
+const DefaultRequestsPerSecond = 2
+
 type TranslationRequest struct {
 	Translate        []string `json:"text"`
 	TargetLang       string   `json:"target_lang"`
@@ -38,66 +61,61 @@ type ApiTranslation struct {
 }
 
 type Api struct {
-	ApiUrl *url.URL
-	Token  string
+	ApiUrl      *url.URL
+	Token       string
+	MaxAttempts int
+	// Timeout of a single request
+	Timeout time.Duration
+	// Limiter may be shared by several apis
+	Limiter *backend.RateLimiter
 }
 
 func CreateApi(apiUrl *url.URL, token string) *Api {
 	return &Api{
-		ApiUrl: apiUrl,
-		Token:  token,
+		ApiUrl:      apiUrl,
+		Token:       token,
+		MaxAttempts: backend.DefaultMaxAttempts,
+		Timeout:     backend.DefaultTimeout,
+		Limiter:     backend.CreateRateLimiter(DefaultRequestsPerSecond, 0),
 	}
 }
 
-func (api Api) Usage() (*UsageResponse, error) {
-	usageUrl := api.ApiUrl.JoinPath(EndpointUsage)
-	request, err := http.NewRequest(
-		"GET",
-		usageUrl.String(),
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
-	request.Header.Set("Authorization", "DeepL-Auth-Key "+api.Token)
-	request.Header.Set("Content-Type", "application/json")
+// IsFreeToken reports whether the token belongs to the free api
+func IsFreeToken(token string) bool {
+	return strings.HasSuffix(token, freeTokenSuffix)
+}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		return nil, err
+// MaskedToken returns the token in a form that is safe to log
+func (api Api) MaskedToken() string {
+	return MaskToken(api.Token)
+}
+
+// MaskToken hides all but the first and last characters of a token
+func MaskToken(token string) string {
+	if len(token) <= 8 {
+		return "****"
 	}
+	return token[:4] + "****" + token[len(token)-4:]
+}
 
-	body, err := io.ReadAll(response.Body)
+func (api Api) Usage(ctx context.Context) (*UsageResponse, error) {
+	usageUrl := api.ApiUrl.JoinPath(EndpointUsage)
+	body, err := api.send(ctx, "GET", usageUrl, nil, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	if response.StatusCode == 403 {
-		logging.Tracef("Deepl Response: %s", string(body))
-		return nil, errors.New("invalid token")
-	}
-
-	if response.StatusCode != 200 {
-		logging.Tracef("Deepl Response: %s", string(body))
-		return nil, errors.New(response.Status)
-	}
-
 	var apiResponse UsageResponse
 	err = json.Unmarshal(body, &apiResponse)
 	if err != nil {
 		return nil, err
 	}
 
-	err = response.Body.Close()
-	if err != nil {
-		return nil, err
-	}
-
 	return &apiResponse, nil
 }
 
 func (api Api) Translate(
+	ctx context.Context,
 	translate []string,
 	sourceLang string,
 	targetLang string,
@@ -127,48 +145,81 @@ func (api Api) Translate(
 		return nil, err
 	}
 
-	request, err := http.NewRequest(
-		"POST",
-		translateUrl.String(),
-		bytes.NewBuffer(requestBody),
-	)
-	if err != nil {
-		return nil, err
+	characters := 0
+	for _, text := range translate {
+		characters += utf8.RuneCountInString(text)
 	}
-	request.Header.Set("Authorization", "DeepL-Auth-Key "+api.Token)
-	request.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	body, err := api.send(ctx, "POST", translateUrl, requestBody, characters)
 	if err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(response.Body)
+	var apiResponse TranslationResponse
+	err = json.Unmarshal(body, &apiResponse)
 	if err != nil {
 		return nil, err
 	}
 
-	if response.StatusCode == 403 {
-		logging.Tracef("Deepl Response: %s", string(body))
-		return nil, errors.New("invalid token")
-	}
+	return &apiResponse, nil
+}
 
-	if response.StatusCode != 200 {
-		logging.Tracef("Deepl Response: %s", string(body))
-		return nil, errors.New(response.Status)
+// Sends a request to the api and retries transient failures.
+// A Retry-After header sent by DeepL takes precedence over the backoff.
+// Every attempt waits for the rate limiter first.
+func (api Api) send(ctx context.Context, method string, endpoint *url.URL, requestBody []byte, characters int) ([]byte, error) {
+	return backend.Retry(ctx, "Deepl", api.MaxAttempts, func() ([]byte, time.Duration, error) {
+		err := api.Limiter.Wait(ctx, characters)
+		if err != nil {
+			return nil, -1, err
+		}
+		body, retryAfter, err := api.sendOnce(ctx, method, endpoint, requestBody)
+		if err == nil {
+			api.Limiter.Succeeded()
+		} else if errors.Is(err, ErrTooManyRequests) {
+			api.Limiter.Throttle()
+		}
+		return body, retryAfter, err
+	})
+}
+
+// Sends a single request to the api.
+// When the request failed the returned duration is negative for
+// permanent failures and zero or the Retry-After delay for transient failures.
+func (api Api) sendOnce(ctx context.Context, method string, endpoint *url.URL, requestBody []byte) ([]byte, time.Duration, error) {
+	var reader io.Reader
+	if requestBody != nil {
+		reader = bytes.NewReader(requestBody)
+	}
+	requestContext, cancel := backend.RequestContext(ctx, api.Timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(requestContext, method, endpoint.String(), reader)
+	if err != nil {
+		return nil, -1, err
 	}
+	request.Header.Set("Authorization", "DeepL-Auth-Key "+api.Token)
+	request.Header.Set("Content-Type", "application/json")
 
-	var apiResponse TranslationResponse
-	err = json.Unmarshal(body, &apiResponse)
+	client := &http.Client{}
+	response, err := client.Do(request)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	defer response.Body.Close()
 
-	err = response.Body.Close()
+	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return &apiResponse, nil
+	if response.StatusCode != 200 {
+		logging.Tracef("Deepl Response: %s", string(body))
+		apiError := newApiError(response, body)
+		if backend.IsTransient(apiError) {
+			return nil, backend.ParseRetryAfter(response.Header.Get("Retry-After")), apiError
+		}
+		return nil, -1, apiError
+	}
+
+	return body, 0, nil
 }
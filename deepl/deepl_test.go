@@ -0,0 +1,113 @@
+package deepl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Creates an api for a stub server that answers
+// the requests with the given handler
+func createTestApi(t *testing.T, handler http.HandlerFunc) *Api {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	apiUrl, err := url.Parse(server.URL + "/v2/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := CreateApi(apiUrl, "token")
+	api.Limiter = nil
+	return api
+}
+
+func TestTranslate(t *testing.T) {
+	api := createTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/translate" || r.Header.Get("Authorization") != "DeepL-Auth-Key token" {
+			t.Errorf("unexpected request %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"translations":[{"text":"Hallo"}]}`))
+	})
+	response, err := api.Translate(context.Background(), []string{"Hello"}, "EN", "DE", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Translations) != 1 || response.Translations[0].Translation != "Hallo" {
+		t.Errorf("got %+v", response.Translations)
+	}
+}
+
+func TestSendHonorsRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	api := createTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"character_count":10,"character_limit":100}`))
+	})
+
+	start := time.Now()
+	usage, err := api.Usage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the Retry-After delay", elapsed)
+	}
+	if usage.CharacterCount != 10 || requests.Load() != 2 {
+		t.Errorf("got %+v after %d requests", usage, requests.Load())
+	}
+}
+
+func TestSendStopsRetrying(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		maxAttempts int
+		err         error
+	}{
+		{name: "quota exceeded", status: StatusQuotaExceeded, maxAttempts: 3, err: ErrQuotaExceeded},
+		{name: "forbidden", status: http.StatusForbidden, maxAttempts: 3, err: ErrAuthorization},
+		{name: "last attempt", status: http.StatusServiceUnavailable, maxAttempts: 1, err: ErrServer},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			api := createTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(test.status)
+			})
+			api.MaxAttempts = test.maxAttempts
+			_, err := api.Usage(context.Background())
+			if !errors.Is(err, test.err) {
+				t.Errorf("got error %v, want %v", err, test.err)
+			}
+			if requests.Load() != 1 {
+				t.Errorf("sent %d requests, want 1", requests.Load())
+			}
+		})
+	}
+}
+
+func TestSendStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	api := createTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	start := time.Now()
+	_, err := api.Usage(ctx)
+	if err == nil {
+		t.Error("cancelled request succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("waited %s for a retry of a cancelled run", elapsed)
+	}
+}
@@ -0,0 +1,69 @@
+package deepl
+
+import (
+	"bahmut.de/pdx-deepl/backend"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// StatusQuotaExceeded is the DeepL specific status
+// code for an exhausted character quota
+const StatusQuotaExceeded = 456
+
+var (
+	ErrAuthorization   = backend.ErrAuthorization
+	ErrQuotaExceeded   = backend.ErrQuotaExceeded
+	ErrTooManyRequests = backend.ErrTooManyRequests
+	ErrPayloadTooLarge = backend.ErrPayloadTooLarge
+	ErrBadRequest      = backend.ErrBadRequest
+	ErrServer          = backend.ErrServer
+)
+
+// ApiError is returned for every non-successful DeepL response.
+// It wraps one of the sentinel errors so callers can use errors.Is
+// or errors.As to react to a specific failure.
+type ApiError struct {
+	StatusCode int
+	Status     string
+	Message    string
+	Err        error
+}
+
+type errorResponse struct {
+	Message string `json:"message"`
+	Detail  string `json:"detail"`
+}
+
+func (err *ApiError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("%s (%s)", err.Err, err.Status)
+	}
+	return fmt.Sprintf("%s (%s): %s", err.Err, err.Status, err.Message)
+}
+
+func (err *ApiError) Unwrap() error {
+	return err.Err
+}
+
+func newApiError(response *http.Response, body []byte) *ApiError {
+	apiError := &ApiError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+	}
+
+	var message errorResponse
+	if json.Unmarshal(body, &message) == nil {
+		apiError.Message = message.Message
+		if message.Detail != "" {
+			apiError.Message = message.Message + ": " + message.Detail
+		}
+	}
+
+	apiError.Err = backend.ErrorForStatus(response.StatusCode)
+	if response.StatusCode == StatusQuotaExceeded {
+		apiError.Err = ErrQuotaExceeded
+	}
+
+	return apiError
+}
@@ -0,0 +1,42 @@
+package deepl
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestNewApiError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		err     error
+		message string
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, err: ErrAuthorization},
+		{name: "forbidden", status: http.StatusForbidden, body: `{"message":"Wrong key"}`, err: ErrAuthorization, message: "Wrong key"},
+		{name: "quota exceeded", status: StatusQuotaExceeded, body: `{"message":"Quota exceeded"}`, err: ErrQuotaExceeded, message: "Quota exceeded"},
+		{name: "too many requests", status: http.StatusTooManyRequests, err: ErrTooManyRequests},
+		{name: "too large", status: http.StatusRequestEntityTooLarge, err: ErrPayloadTooLarge},
+		{name: "unavailable", status: http.StatusServiceUnavailable, err: ErrServer},
+		{name: "server error", status: http.StatusInternalServerError, body: "<html>", err: ErrServer},
+		{
+			name: "bad request", status: http.StatusBadRequest, body: `{"message":"Bad request","detail":"Value for 'target_lang' not supported."}`,
+			err: ErrBadRequest, message: "Bad request: Value for 'target_lang' not supported.",
+		},
+		{name: "not found", status: http.StatusNotFound, err: ErrBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := &http.Response{StatusCode: test.status, Status: http.StatusText(test.status)}
+			apiError := newApiError(response, []byte(test.body))
+			if !errors.Is(apiError, test.err) {
+				t.Errorf("got %v, want %v", apiError.Err, test.err)
+			}
+			if apiError.Message != test.message || apiError.StatusCode != test.status {
+				t.Errorf("got message %q with status %d, want %q with %d", apiError.Message, apiError.StatusCode, test.message, test.status)
+			}
+		})
+	}
+}
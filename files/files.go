@@ -0,0 +1,34 @@
+package files
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic writes a file through a temporary file in the same directory,
+// so that a crash while writing does not destroy the previous version.
+// The temporary file starts with a dot, ends with .tmp
+// and is removed when writing fails.
+func WriteAtomic(path string, write func(writer *bufio.Writer)) error {
+	output, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(output.Name())
+
+	writer := bufio.NewWriterSize(output, 64*1024)
+	write(writer)
+	err = writer.Flush()
+	if err == nil {
+		err = output.Chmod(0644)
+	}
+	closeErr := output.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(output.Name(), path)
+}
@@ -0,0 +1,44 @@
+package files
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "test_l_german.yml")
+	err := os.WriteFile(path, []byte("old"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = WriteAtomic(path, func(writer *bufio.Writer) {
+		writer.WriteString("new")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "new" {
+		t.Errorf("got %q, want new", content)
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, want no temporary file left", len(entries))
+	}
+
+	// Writing into a missing directory keeps nothing behind
+	err = WriteAtomic(filepath.Join(directory, "missing", "file.yml"), func(writer *bufio.Writer) {})
+	if err == nil {
+		t.Error("writing into a missing directory succeeded")
+	}
+}
@@ -0,0 +1,177 @@
+package google
+
+import (
+	"bahmut.de/pdx-deepl/backend"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const BackendName = "google"
+
+// DefaultApiUrl is the base url of the Cloud Translation api
+const DefaultApiUrl = "https://translation.googleapis.com/"
+
+const EndpointTranslate = "language/translate/v2"
+const EndpointLanguages = "language/translate/v2/languages"
+
+// MaxTexts is the maximum number of texts
+// Google accepts in a single translate request
+const MaxTexts = 128
+
+// MaxRequestSize is the recommended maximum
+// size of a translate request in bytes
+const MaxRequestSize = 30 * 1024
+
+// Languages maps paradox language names to Google language codes
+var Languages = map[string]string{
+	"english":      "en",
+	"french":       "fr",
+	"german":       "de",
+	"spanish":      "es",
+	"japanese":     "ja",
+	"korean":       "ko",
+	"polish":       "pl",
+	"russian":      "ru",
+	"turkish":      "tr",
+	"braz_por":     "pt",
+	"simp_chinese": "zh-CN",
+}
+
+type TranslationRequest struct {
+	Translate  []string `json:"q"`
+	SourceLang string   `json:"source"`
+	TargetLang string   `json:"target"`
+	Format     string   `json:"format"`
+}
+
+type TranslationResponse struct {
+	Data struct {
+		Translations []*ApiTranslation `json:"translations"`
+	} `json:"data"`
+}
+
+type ApiTranslation struct {
+	Translation string `json:"translatedText"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Api is a client for the Google Cloud Translation v2 (basic) api
+type Api struct {
+	ApiUrl      *url.URL
+	ApiKey      string
+	MaxAttempts int
+	// Timeout of a single request
+	Timeout time.Duration
+}
+
+func CreateApi(apiUrl *url.URL, apiKey string) *Api {
+	return &Api{
+		ApiUrl:      apiUrl,
+		ApiKey:      apiKey,
+		MaxAttempts: backend.DefaultMaxAttempts,
+		Timeout:     backend.DefaultTimeout,
+	}
+}
+
+func (api *Api) Name() string {
+	return BackendName
+}
+
+func (api *Api) Capabilities() backend.Capabilities {
+	return backend.Capabilities{
+		TagHandling:    true,
+		Glossary:       false,
+		MaxTexts:       MaxTexts,
+		MaxRequestSize: MaxRequestSize,
+	}
+}
+
+// Usage checks the api key and reports an unlimited quota
+// since the v2 api does not expose the character usage
+func (api *Api) Usage(ctx context.Context) (*backend.Usage, error) {
+	_, err := api.send(ctx, "GET", api.ApiUrl.JoinPath(EndpointLanguages), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &backend.Usage{}, nil
+}
+
+func (api *Api) Translate(ctx context.Context, request *backend.Request) (*backend.Response, error) {
+	sourceLang, ok := Languages[request.SourceLanguage.Name]
+	if !ok {
+		return nil, fmt.Errorf("language not supported by %s: %s", BackendName, request.SourceLanguage.Name)
+	}
+	targetLang, ok := Languages[request.TargetLanguage.Name]
+	if !ok {
+		return nil, fmt.Errorf("language not supported by %s: %s", BackendName, request.TargetLanguage.Name)
+	}
+
+	// Html mode keeps the escaped functions and references intact
+	texts := make([]string, len(request.Texts))
+	protected := make([][]string, len(request.Texts))
+	for i, text := range request.Texts {
+		texts[i], protected[i] = backend.EncodeHtml(text, request.IgnoreTags)
+	}
+
+	requestBody, err := json.Marshal(TranslationRequest{
+		Translate:  texts,
+		SourceLang: sourceLang,
+		TargetLang: targetLang,
+		Format:     "html",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := api.send(ctx, "POST", api.ApiUrl.JoinPath(EndpointTranslate), requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var apiResponse TranslationResponse
+	err = json.Unmarshal(body, &apiResponse)
+	if err != nil {
+		return nil, err
+	}
+	if len(apiResponse.Data.Translations) != len(texts) {
+		return nil, fmt.Errorf("expected %d translations but got %d", len(texts), len(apiResponse.Data.Translations))
+	}
+
+	translations := make([]string, len(texts))
+	for i, translation := range apiResponse.Data.Translations {
+		translations[i], err = backend.DecodeHtml(translation.Translation, protected[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &backend.Response{Translations: translations}, nil
+}
+
+// Sends a request to the api. The key is sent as a header,
+// because errors of failed requests contain the url.
+func (api *Api) send(ctx context.Context, method string, endpoint *url.URL, requestBody []byte) ([]byte, error) {
+	request, err := http.NewRequest(method, endpoint.String(), bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Goog-Api-Key", api.ApiKey)
+	return backend.Send(ctx, api.Timeout, api.MaxAttempts, request, "Google", errorMessage)
+}
+
+func errorMessage(body []byte) string {
+	var message errorResponse
+	if json.Unmarshal(body, &message) != nil {
+		return ""
+	}
+	return message.Error.Message
+}
@@ -0,0 +1,221 @@
+package libretranslate
+
+import (
+	"bahmut.de/pdx-deepl/backend"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+const BackendName = "libretranslate"
+
+const EndpointTranslate = "translate"
+const EndpointLanguages = "languages"
+
+// MaxTexts is the number of texts sent in one request.
+// LibreTranslate itself has no fixed limit, but a self-hosted
+// instance answers faster with smaller batches.
+const MaxTexts = 25
+
+// MaxRequestSize is the maximum size of one request in bytes
+const MaxRequestSize = 64 * 1024
+
+// Languages maps paradox language names to LibreTranslate codes.
+// Codes are listed by preference because newer LibreTranslate
+// versions use regional codes where older ones do not.
+var Languages = map[string][]string{
+	"english":      {"en"},
+	"french":       {"fr"},
+	"german":       {"de"},
+	"spanish":      {"es"},
+	"japanese":     {"ja"},
+	"korean":       {"ko"},
+	"polish":       {"pl"},
+	"russian":      {"ru"},
+	"turkish":      {"tr"},
+	"braz_por":     {"pt-BR", "pt"},
+	"simp_chinese": {"zh-Hans", "zh"},
+}
+
+type TranslationRequest struct {
+	Translate  []string `json:"q"`
+	SourceLang string   `json:"source"`
+	TargetLang string   `json:"target"`
+	Format     string   `json:"format"`
+	ApiKey     string   `json:"api_key,omitempty"`
+}
+
+type TranslationResponse struct {
+	Translations []string `json:"translatedText"`
+}
+
+type ApiLanguage struct {
+	Code    string   `json:"code"`
+	Name    string   `json:"name"`
+	Targets []string `json:"targets"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Api is a client for a (self-hosted) LibreTranslate instance
+type Api struct {
+	ApiUrl      *url.URL
+	ApiKey      string
+	MaxAttempts int
+	// Timeout of a single request
+	Timeout time.Duration
+
+	languagesLock sync.Mutex
+	languages     []*ApiLanguage
+}
+
+func CreateApi(apiUrl *url.URL, apiKey string) *Api {
+	return &Api{
+		ApiUrl:      apiUrl,
+		ApiKey:      apiKey,
+		MaxAttempts: backend.DefaultMaxAttempts,
+		Timeout:     backend.DefaultTimeout,
+	}
+}
+
+func (api *Api) Name() string {
+	return BackendName
+}
+
+func (api *Api) Capabilities() backend.Capabilities {
+	return backend.Capabilities{
+		TagHandling:    true,
+		Glossary:       false,
+		MaxTexts:       MaxTexts,
+		MaxRequestSize: MaxRequestSize,
+	}
+}
+
+// Usage reports an unlimited quota since
+// LibreTranslate does not count characters
+func (api *Api) Usage(ctx context.Context) (*backend.Usage, error) {
+	_, err := api.Languages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &backend.Usage{}, nil
+}
+
+func (api *Api) Translate(ctx context.Context, request *backend.Request) (*backend.Response, error) {
+	sourceLang, err := api.resolveLanguage(ctx, request.SourceLanguage.Name)
+	if err != nil {
+		return nil, err
+	}
+	targetLang, err := api.resolveLanguage(ctx, request.TargetLanguage.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Html mode keeps the escaped functions and references intact
+	texts := make([]string, len(request.Texts))
+	protected := make([][]string, len(request.Texts))
+	for i, text := range request.Texts {
+		texts[i], protected[i] = backend.EncodeHtml(text, request.IgnoreTags)
+	}
+
+	requestBody, err := json.Marshal(TranslationRequest{
+		Translate:  texts,
+		SourceLang: sourceLang,
+		TargetLang: targetLang,
+		Format:     "html",
+		ApiKey:     api.ApiKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := api.send(ctx, "POST", api.ApiUrl.JoinPath(EndpointTranslate), requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var apiResponse TranslationResponse
+	err = json.Unmarshal(body, &apiResponse)
+	if err != nil {
+		return nil, err
+	}
+	if len(apiResponse.Translations) != len(texts) {
+		return nil, fmt.Errorf("expected %d translations but got %d", len(texts), len(apiResponse.Translations))
+	}
+
+	translations := make([]string, len(texts))
+	for i, translation := range apiResponse.Translations {
+		translations[i], err = backend.DecodeHtml(translation, protected[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &backend.Response{Translations: translations}, nil
+}
+
+// Languages returns the languages supported by the instance
+func (api *Api) Languages(ctx context.Context) ([]*ApiLanguage, error) {
+	api.languagesLock.Lock()
+	defer api.languagesLock.Unlock()
+	if api.languages != nil {
+		return api.languages, nil
+	}
+
+	body, err := api.send(ctx, "GET", api.ApiUrl.JoinPath(EndpointLanguages), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var languages []*ApiLanguage
+	err = json.Unmarshal(body, &languages)
+	if err != nil {
+		return nil, err
+	}
+	api.languages = languages
+	return languages, nil
+}
+
+// Maps a paradox language name to a code the instance supports
+func (api *Api) resolveLanguage(ctx context.Context, name string) (string, error) {
+	candidates, ok := Languages[name]
+	if !ok {
+		return "", fmt.Errorf("language not supported by %s: %s", BackendName, name)
+	}
+	languages, err := api.Languages(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, candidate := range candidates {
+		supported := slices.ContainsFunc(languages, func(language *ApiLanguage) bool {
+			return language.Code == candidate
+		})
+		if supported {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("language not available on %s instance: %s", BackendName, name)
+}
+
+func (api *Api) send(ctx context.Context, method string, endpoint *url.URL, requestBody []byte) ([]byte, error) {
+	request, err := http.NewRequest(method, endpoint.String(), bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	return backend.Send(ctx, api.Timeout, api.MaxAttempts, request, "LibreTranslate", errorMessage)
+}
+
+func errorMessage(body []byte) string {
+	var message errorResponse
+	if json.Unmarshal(body, &message) != nil {
+		return ""
+	}
+	return message.Error
+}
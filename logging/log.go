@@ -3,6 +3,7 @@ package logging
 import (
 	"log"
 	"os"
+	"sync"
 )
 
 const (
@@ -37,9 +38,12 @@ var GlobalLogger = New()
 // that includes:
 //   - log levels
 //   - ansi colors
+//
+// It is safe to use from multiple goroutines.
 type Logger struct {
 	MinLogLevel int
 	*log.Logger
+	lock sync.Mutex
 }
 
 func New() *Logger {
@@ -54,92 +58,113 @@ func (logger *Logger) Trace(v ...any) {
 	if logger.MinLogLevel > LevelTrace {
 		return
 	}
-	logger.SetPrefix(PrefixTrace)
-	logger.Println(v...)
+	logger.print(PrefixTrace, func() {
+		logger.Println(v...)
+	})
 }
 
 func (logger *Logger) Tracef(format string, v ...any) {
 	if logger.MinLogLevel > LevelTrace {
 		return
 	}
-	logger.SetPrefix(PrefixTrace)
-	logger.Printf(format, v...)
+	logger.print(PrefixTrace, func() {
+		logger.Printf(format, v...)
+	})
 }
 
 func (logger *Logger) Debug(v ...any) {
 	if logger.MinLogLevel > LevelDebug {
 		return
 	}
-	logger.SetPrefix(PrefixDebug)
-	logger.Println(v...)
+	logger.print(PrefixDebug, func() {
+		logger.Println(v...)
+	})
 }
 
 func (logger *Logger) Debugf(format string, v ...any) {
 	if logger.MinLogLevel > LevelDebug {
 		return
 	}
-	logger.SetPrefix(PrefixDebug)
-	logger.Printf(format, v...)
+	logger.print(PrefixDebug, func() {
+		logger.Printf(format, v...)
+	})
 }
 
 func (logger *Logger) Info(v ...any) {
 	if logger.MinLogLevel > LevelInfo {
 		return
 	}
-	logger.SetPrefix(PrefixInfo)
-	logger.Println(v...)
+	logger.print(PrefixInfo, func() {
+		logger.Println(v...)
+	})
 }
 
 func (logger *Logger) Infof(format string, v ...any) {
 	if logger.MinLogLevel > LevelInfo {
 		return
 	}
-	logger.SetPrefix(PrefixInfo)
-	logger.Printf(format, v...)
+	logger.print(PrefixInfo, func() {
+		logger.Printf(format, v...)
+	})
 }
 
 func (logger *Logger) Warn(v ...any) {
 	if logger.MinLogLevel > LevelWarn {
 		return
 	}
-	logger.SetPrefix(PrefixWarn)
-	logger.Println(v...)
+	logger.print(PrefixWarn, func() {
+		logger.Println(v...)
+	})
 }
 
 func (logger *Logger) Warnf(format string, v ...any) {
 	if logger.MinLogLevel > LevelWarn {
 		return
 	}
-	logger.SetPrefix(PrefixWarn)
-	logger.Printf(format, v...)
+	logger.print(PrefixWarn, func() {
+		logger.Printf(format, v...)
+	})
 }
 
 func (logger *Logger) Error(v ...any) {
 	if logger.MinLogLevel > LevelError {
 		return
 	}
-	logger.SetPrefix(PrefixError)
-	logger.Println(v...)
+	logger.print(PrefixError, func() {
+		logger.Println(v...)
+	})
 }
 
 func (logger *Logger) Errorf(format string, v ...any) {
 	if logger.MinLogLevel > LevelError {
 		return
 	}
-	logger.SetPrefix(PrefixError)
-	logger.Printf(format, v...)
+	logger.print(PrefixError, func() {
+		logger.Printf(format, v...)
+	})
 }
 
 func (logger *Logger) Fatal(v ...any) {
+	logger.lock.Lock()
 	logger.SetPrefix(PrefixFatal)
 	logger.Logger.Fatal(v...)
 }
 
 func (logger *Logger) Fatalf(format string, v ...any) {
+	logger.lock.Lock()
 	logger.SetPrefix(PrefixFatal)
 	logger.Logger.Fatalf(format, v...)
 }
 
+// Sets the prefix and prints while holding the lock
+// so that concurrent calls can not swap the prefix
+func (logger *Logger) print(prefix string, print func()) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	logger.SetPrefix(prefix)
+	print()
+}
+
 func Trace(v ...any) {
 	GlobalLogger.Trace(v...)
 }
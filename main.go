@@ -1,42 +1,104 @@
 package main
 
 import (
+	"bahmut.de/pdx-deepl/backend"
 	"bahmut.de/pdx-deepl/deepl"
 	"bahmut.de/pdx-deepl/logging"
+	"bahmut.de/pdx-deepl/memory"
 	"bahmut.de/pdx-deepl/pdx"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
-)
-
-const (
-	ApiFree = "free"
-	ApiPaid = "paid"
+	"slices"
+	"strings"
+	"syscall"
 )
 
 const (
 	FlagApiType      = "api-type"
 	FlagApiToken     = "api-token"
+	FlagApiUrl       = "api-url"
 	FlagConfig       = "config"
 	FlagStatistics   = "stats"
+	FlagLint         = "lint"
 	FlagLocalization = "localization"
+	FlagMaxAttempts  = "max-attempts"
+	FlagModel        = "model"
+	FlagPrompt       = "prompt"
+	FlagRequestRate  = "requests-per-second"
+	FlagCharRate     = "characters-per-minute"
+	FlagWorkers      = "workers"
+	FlagTimeout      = "request-timeout"
+	FlagCheckpoint   = "checkpoint-keys"
+	FlagCheckpointIn = "checkpoint-interval"
+	FlagQuotaPolicy  = "quota-policy"
+	FlagMaxChars     = "max-characters"
+	FlagMaxDuration  = "max-duration"
+	FlagMemory       = "memory"
+	FlagFuzzy        = "fuzzy-threshold"
+	FlagSegment      = "segment-sentences"
+	FlagFuzzyReport  = "fuzzy-report"
+	FlagFuzzyDrafts  = "fuzzy-drafts"
+	FlagVersions     = "version-changes"
+	FlagOrphans      = "orphans"
+	FlagNoBom        = "no-bom"
+	FlagFixEncoding  = "fix-encoding"
 )
 
 func main() {
 	localizationLocation := flag.String(FlagLocalization, ".", "Optional: Path to localization directory of your mod")
-	apiType := flag.String(FlagApiType, ApiFree, "Optional: Whether to use free or paid Deepl API")
-	token := flag.String(FlagApiToken, "", "Required: Deepl API Token")
+	apiType := flag.String(FlagApiType, ApiDeepl, "Optional: Which translation API to use (deepl, free, paid, libretranslate, openai or google). With deepl free or paid is detected from the token")
+	token := flag.String(FlagApiToken, "", "Required: API Token (Optional for libretranslate and openai)")
+	apiUrlOverride := flag.String(FlagApiUrl, "", "Optional: URL of the translation API e.g. a proxy (Required for libretranslate and openai)")
+	model := flag.String(FlagModel, "", "Optional: Model used for translations (Required for openai)")
+	prompt := flag.String(FlagPrompt, "", "Optional: Path to a prompt template file for openai")
 	config := flag.String(FlagConfig, pdx.DefaultConfigFile, "Optional: Path to translation config file")
+	maxAttempts := flag.Int(FlagMaxAttempts, backend.DefaultMaxAttempts, "Optional: How often a request is sent to the translation API before a localization key is skipped")
+	requestRate := flag.Float64(FlagRequestRate, deepl.DefaultRequestsPerSecond, "Optional: Maximum number of requests per second sent to the Deepl API (0 for no limit)")
+	characterRate := flag.Int(FlagCharRate, 0, "Optional: Maximum number of characters per minute sent to the Deepl API (0 for no limit)")
+	workers := flag.Int(FlagWorkers, 1, "Optional: Number of localization files that are translated at the same time")
+	timeout := flag.Duration(FlagTimeout, backend.DefaultTimeout, "Optional: Time after which a single request to the translation API is cancelled")
+	checkpointKeys := flag.Int(FlagCheckpoint, pdx.DefaultCheckpointKeys, "Optional: Number of translated localization keys after which a file is written while it is translated (0 to disable)")
+	checkpointInterval := flag.Duration(FlagCheckpointIn, pdx.DefaultCheckpointInterval, "Optional: Time after which a file is written while it is translated (0 to disable)")
+	quotaPolicy := flag.String(FlagQuotaPolicy, QuotaFit, "Optional: What to do when the run needs more characters than the API quota has left (abort, confirm or fit)")
+	maxCharacters := flag.Int(FlagMaxChars, 0, "Optional: Maximum number of characters translated in this run (0 for no limit)")
+	maxDuration := flag.Duration(FlagMaxDuration, 0, "Optional: Time after which the translation stops and writes what was translated (0 for no limit)")
+	memoryFile := flag.String(FlagMemory, "", "Optional: Path to a translation memory file that is used and updated by the run (Overrides the config)")
+	fuzzyThreshold := flag.Float64(FlagFuzzy, pdx.DefaultFuzzyThreshold, "Optional: Minimum similarity between 0 and 1 of texts for fuzzy matches")
+	fuzzyReport := flag.String(FlagFuzzyReport, "", "Optional: Path to a CSV file that lists translations of similar texts for the translated keys")
+	fuzzyDrafts := flag.Bool(FlagFuzzyDrafts, false, "Optional: When set uses translations of similar texts as drafts marked for review instead of translating the keys")
+	segmentSentences := flag.Bool(FlagSegment, false, "Optional: When set translates every sentence on its own and keeps the translations in the translation memory, so that only changed sentences are translated again")
+	versionChanges := flag.Bool(FlagVersions, false, "Optional: When set retranslates localization keys whose version number in the base language changed (e.g. key:0 to key:1), even when the text is the same")
+	orphans := flag.String(FlagOrphans, pdx.OrphansKeep, "Optional: What happens to localization keys that only exist in a target file (keep, report or prune)")
+	noBom := flag.Bool(FlagNoBom, false, "Optional: When set writes target files without a UTF-8 byte order mark unless the base file has one (Overrides the config)")
+	fixEncoding := flag.Bool(FlagFixEncoding, false, "Optional: When set converts the localization files to UTF-8 with a byte order mark and does not translate anything")
 	stats := flag.Bool(FlagStatistics, false, "Optional: When set produces relevant statistics about the localization like the character count")
+	lint := flag.Bool(FlagLint, false, "Optional: When set checks the localization files for invalid lines, language headers, duplicate keys and markers")
 	flag.Parse()
 
-	if token == nil || *token == "" {
-		fmt.Printf("The parameter %s%s%s is required.\n\n", logging.AnsiBoldOn, FlagApiToken, logging.AnsiAllDefault)
+	if !slices.Contains(QuotaPolicies, *quotaPolicy) {
+		fmt.Printf("The parameter %s%s%s has to be one of: %s\n\n", logging.AnsiBoldOn, FlagQuotaPolicy, logging.AnsiAllDefault, strings.Join(QuotaPolicies, ", "))
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
+	if !slices.Contains(pdx.OrphanPolicies, *orphans) {
+		fmt.Printf("The parameter %s%s%s has to be one of: %s\n\n", logging.AnsiBoldOn, FlagOrphans, logging.AnsiAllDefault, strings.Join(pdx.OrphanPolicies, ", "))
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	// Cancel running requests on Ctrl+C and write what was translated.
+	// A second Ctrl+C terminates immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
 	var resolvedConfigFile string
 	if config == nil || *config == "" {
@@ -57,6 +119,16 @@ func main() {
 
 	logging.Infof("%sTranslation Config:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, configPath)
 
+	translationConfig, err := pdx.ReadConfigFile(configPath)
+	if err != nil {
+		logging.Fatalf("Could not load config file: %s", err)
+		os.Exit(1)
+	}
+
+	if *noBom {
+		translationConfig.NoByteOrderMark = true
+	}
+
 	var resolvedLocalizationDirectory string
 	if localizationLocation == nil || *localizationLocation == "" {
 		resolvedLocalizationDirectory = "."
@@ -76,61 +148,215 @@ func main() {
 
 	logging.Infof("%sLocalization Directory:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, localizationPath)
 
-	var apiUrl *url.URL
+	if *fixEncoding || *lint || *stats {
+		// Commands that only work on the local files
+		// do not need a translation API
+		localTranslator, err := pdx.CreateTranslator(translationConfig, resolvedLocalizationDirectory, nil)
+		if err != nil {
+			logging.Fatalf("Could not initialize %sPDX Translator%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
+			os.Exit(1)
+		}
+		switch {
+		case *fixEncoding:
+			fixed, err := localTranslator.FixEncoding()
+			if err != nil {
+				logging.Fatalf("Could not fix encoding of %sLocalization Files%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
+				os.Exit(1)
+			}
+			logging.Infof("%sFixed Files:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, fixed)
+		case *lint:
+			problems, err := localTranslator.Lint()
+			if err != nil {
+				logging.Fatalf("Could not lint %sLocalization Files%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
+				os.Exit(1)
+			}
+			if problems > 0 {
+				logging.Fatalf("Found %d problems in the %sLocalization Files%s", problems, logging.AnsiBoldOn, logging.AnsiAllDefault)
+				os.Exit(1)
+			}
+			logging.Infof("%sLocalization Files%s have no problems", logging.AnsiBoldOn, logging.AnsiAllDefault)
+		default:
+			err = localTranslator.Statistics()
+			if err != nil {
+				logging.Fatalf("Could not calculate %sStatistics%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	if len(translationConfig.Backends) == 0 && (token == nil || *token == "") && (apiType == nil || requiresToken(*apiType)) {
+		fmt.Printf("The parameter %s%s%s is required.\n\n", logging.AnsiBoldOn, FlagApiToken, logging.AnsiAllDefault)
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
 
-	var resolvedApiType string
+	var translationBackend backend.Backend
+	if len(translationConfig.Backends) > 0 {
+		// Backends of the config file are used as a fallback chain
+		backends := make([]backend.Backend, len(translationConfig.Backends))
+		for i, configBackend := range translationConfig.Backends {
+			backends[i], err = createBackend(ctx, &BackendSettings{
+				Type:        configBackend.Type,
+				Url:         configBackend.Url,
+				Token:       configBackend.Token,
+				Model:       configBackend.Model,
+				Prompt:      configBackend.Prompt,
+				MaxAttempts: *maxAttempts,
+				Timeout:     *timeout,
 
-	if apiType == nil {
-		resolvedApiType = ApiFree
+				RequestsPerSecond:   *requestRate,
+				CharactersPerMinute: *characterRate,
+			})
+			if err != nil {
+				logging.Fatalf("Could not initialize %sTranslation API%s %d (%s): %s", logging.AnsiBoldOn, logging.AnsiAllDefault, i+1, configBackend.Type, err)
+				os.Exit(1)
+			}
+			logging.Infof("%sAPI Type %d:%s %s", logging.AnsiBoldOn, i+1, logging.AnsiAllDefault, configBackend.Type)
+		}
+		translationBackend = backend.CreateChain(backends...)
 	} else {
-		resolvedApiType = *apiType
-	}
+		var resolvedApiType string
 
-	switch resolvedApiType {
-	case ApiFree:
-		parsedUrl, err := url.Parse("https://api-free.deepl.com/v2/")
-		if err != nil {
-			logging.Fatal("Could not parse free api url")
+		if apiType == nil || *apiType == "" {
+			resolvedApiType = ApiDeepl
+		} else {
+			resolvedApiType = *apiType
 		}
-		apiUrl = parsedUrl
-	case ApiPaid:
-		parsedUrl, err := url.Parse("https://api.deepl.com/v2/")
+
+		translationBackend, err = createBackend(ctx, &BackendSettings{
+			Type:        resolvedApiType,
+			Url:         *apiUrlOverride,
+			Token:       *token,
+			Model:       *model,
+			Prompt:      *prompt,
+			MaxAttempts: *maxAttempts,
+			Timeout:     *timeout,
+
+			RequestsPerSecond:   *requestRate,
+			CharactersPerMinute: *characterRate,
+		})
 		if err != nil {
-			logging.Fatal("Could not parse paid api url")
+			logging.Fatalf("Could not initialize %sTranslation API%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err)
 			os.Exit(1)
 		}
-		apiUrl = parsedUrl
-		break
-	default:
-		logging.Fatalf("API type %s%s%s unknown please choose one of %s or %s", logging.AnsiBoldOn, resolvedApiType, logging.AnsiAllDefault, ApiFree, ApiPaid)
+		logging.Infof("%sAPI Type:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, resolvedApiType)
 	}
-	logging.Infof("%sAPI Type:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, resolvedApiType)
 
-	translatorApi := deepl.CreateApi(apiUrl, *token)
-	response, err := translatorApi.Usage()
+	response, err := translationBackend.Usage(ctx)
 	if err != nil {
-		logging.Fatalf("Could not initialize %sDeepl API%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
+		logging.Fatalf("Could not initialize %s%s API%s: %s", logging.AnsiBoldOn, translationBackend.Name(), logging.AnsiAllDefault, err.Error())
 		os.Exit(1)
 	}
-	logging.Infof("%sAPI Character Usage:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, response.CharacterCount)
-	logging.Infof("%sAPI Character Limit:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, response.CharacterLimit)
+	if !response.Limited() {
+		logging.Infof("%sAPI Character Limit:%s none", logging.AnsiBoldOn, logging.AnsiAllDefault)
+	} else {
+		logging.Infof("%sAPI Character Usage:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, response.CharacterCount)
+		logging.Infof("%sAPI Character Limit:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, response.CharacterLimit)
+	}
 
-	translatorPdx, err := pdx.CreateTranslator(resolvedConfigFile, resolvedLocalizationDirectory, translatorApi)
+	translatorPdx, err := pdx.CreateTranslator(translationConfig, resolvedLocalizationDirectory, translationBackend)
 	if err != nil {
 		logging.Fatalf("Could not initialize %sPDX Translator%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
 		os.Exit(1)
 	}
+	if workers != nil && *workers > 1 {
+		translatorPdx.Workers = *workers
+	}
+	translatorPdx.CheckpointKeys = *checkpointKeys
+	translatorPdx.CheckpointInterval = *checkpointInterval
+	translatorPdx.CharacterBudget = *maxCharacters
 
-	if stats != nil && *stats {
-		err = translatorPdx.Statistics()
+	resolvedMemoryFile := translationConfig.Memory
+	if *memoryFile != "" {
+		resolvedMemoryFile = *memoryFile
+	}
+	if resolvedMemoryFile != "" {
+		translatorPdx.Memory, err = memory.ReadMemoryFile(resolvedMemoryFile)
 		if err != nil {
-			logging.Fatalf("Could not calculate %sStatistics%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
+			logging.Fatalf("Could not initialize %sTranslation Memory%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
 			os.Exit(1)
 		}
-		return
+		logging.Infof("%sTranslation Memory:%s %s (%d entries)", logging.AnsiBoldOn, logging.AnsiAllDefault, resolvedMemoryFile, translatorPdx.Memory.Len())
+	}
+
+	if *segmentSentences {
+		translatorPdx.SegmentSentences = true
+		if translatorPdx.Memory == nil {
+			logging.Warnf("Sentences are only kept for this run, use a %sTranslation Memory%s to keep them for the next run", logging.AnsiBoldOn, logging.AnsiAllDefault)
+		}
+	}
+	if translatorPdx.Memory == nil {
+		// Identical texts are still only translated once per run
+		translatorPdx.Memory = memory.CreateMemory()
+	}
+
+	translatorPdx.VersionChanges = *versionChanges
+	translatorPdx.OrphanPolicy = *orphans
+
+	if *fuzzyReport != "" || *fuzzyDrafts {
+		translatorPdx.FuzzyThreshold = *fuzzyThreshold
+		translatorPdx.FuzzyDrafts = *fuzzyDrafts
+	}
+
+	plan, err := translatorPdx.Plan()
+	if err != nil {
+		logging.Fatalf("Could not plan %sTranslation%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
+		os.Exit(1)
+	}
+	start, err := applyQuotaPolicy(*quotaPolicy, plan, response, translatorPdx)
+	if err != nil {
+		logging.Fatalf("Could not apply %sQuota Policy%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
+		os.Exit(1)
+	}
+	if !start {
+		logging.Fatalf("%sTranslation was not started%s because of the API quota", logging.AnsiBoldOn, logging.AnsiAllDefault)
+		os.Exit(1)
 	}
 
-	err = translatorPdx.Translate()
+	translateCtx := ctx
+	if *maxDuration > 0 {
+		var cancel context.CancelFunc
+		translateCtx, cancel = context.WithTimeout(ctx, *maxDuration)
+		defer cancel()
+	}
+
+	err = translatorPdx.Translate(translateCtx)
+	reportUsage(ctx, translationBackend, response)
+	if translatorPdx.Memory != nil {
+		memoryErr := translatorPdx.Memory.Save()
+		if memoryErr != nil {
+			logging.Errorf("Could not save %sTranslation Memory%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, memoryErr)
+		}
+	}
+	if *fuzzyReport != "" {
+		reportErr := pdx.WriteFuzzyReport(*fuzzyReport, translatorPdx.FuzzyMatches)
+		if reportErr != nil {
+			logging.Errorf("Could not write %sFuzzy Report%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, reportErr)
+		} else {
+			logging.Infof("%sFuzzy Report:%s %d similar texts in %s", logging.AnsiBoldOn, logging.AnsiAllDefault, len(translatorPdx.FuzzyMatches), *fuzzyReport)
+		}
+	}
+	if len(translatorPdx.Pending) > 0 {
+		pendingKeys := 0
+		for _, pending := range translatorPdx.Pending {
+			logging.Warnf("%s%s%s: %d localization keys pending", logging.AnsiBoldOn, pending.FileName, logging.AnsiAllDefault, pending.Keys)
+			pendingKeys += pending.Keys
+		}
+		logging.Warnf(
+			"%sPending:%s %d localization keys in %d files are left for the next run",
+			logging.AnsiBoldOn, logging.AnsiAllDefault, pendingKeys, len(translatorPdx.Pending),
+		)
+	}
+	if errors.Is(translateCtx.Err(), context.DeadlineExceeded) {
+		// Reaching the maximum duration is a planned end of the run
+		logging.Warnf("%sTranslation stopped%s after the maximum duration of %s", logging.AnsiBoldOn, logging.AnsiAllDefault, *maxDuration)
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		logging.Fatalf("%sTranslation was cancelled%s", logging.AnsiBoldOn, logging.AnsiAllDefault)
+		os.Exit(1)
+	}
 	if err != nil {
 		logging.Fatalf("Could not run %sPDX Translator%s: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err.Error())
 		os.Exit(1)
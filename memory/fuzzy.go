@@ -0,0 +1,176 @@
+package memory
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Paradox markup is kept as a single token: functions, references,
+// icons, formatting and line breaks. Only words are compared case-insensitively.
+var tokenExpression = regexp.MustCompile(`\[[^\]]*\]|\$[^$]*\$|£[^£]*£|@[^!\s]+!|#!|#[a-zA-Z_]+\s?|\\n|[\p{L}\p{N}]+|\S`)
+
+// Match is a translation of a similar source text
+type Match struct {
+	Source      string
+	Translation string
+	Similarity  float64
+}
+
+// Index finds translations of texts with at least the similarity of the threshold.
+// Adding texts is not safe while searching, searching is safe
+// from multiple goroutines.
+type Index struct {
+	Threshold float64
+
+	entries  []*indexEntry
+	sources  map[string]bool
+	postings map[string][]int
+
+	lock    sync.Mutex
+	results map[string]*Match
+}
+
+type indexEntry struct {
+	Source      string
+	Translation string
+	Tokens      []string
+	Counts      map[string]int
+}
+
+func CreateIndex(threshold float64) *Index {
+	return &Index{
+		Threshold: threshold,
+		sources:   make(map[string]bool),
+		postings:  make(map[string][]int),
+		results:   make(map[string]*Match),
+	}
+}
+
+// Tokenize splits a text into words, punctuation and Paradox markup
+func Tokenize(text string) []string {
+	tokens := tokenExpression.FindAllString(text, -1)
+	for i, token := range tokens {
+		first, _ := utf8.DecodeRuneInString(token)
+		if unicode.IsLetter(first) || unicode.IsNumber(first) {
+			tokens[i] = strings.ToLower(token)
+		} else {
+			tokens[i] = strings.TrimSpace(token)
+		}
+	}
+	return tokens
+}
+
+// Similarity of two token lists between 0 and 1
+// based on the edit distance of their tokens
+func Similarity(a, b []string) float64 {
+	longest := max(len(a), len(b))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(a, b))/float64(longest)
+}
+
+func editDistance(a, b []string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Add indexes the translation of a source text.
+// The first translation of a source text is kept.
+func (index *Index) Add(source, translation string) {
+	if index.sources[source] {
+		return
+	}
+	index.sources[source] = true
+	tokens := Tokenize(source)
+	counts := make(map[string]int)
+	for _, token := range tokens {
+		counts[token]++
+	}
+	for token := range counts {
+		index.postings[token] = append(index.postings[token], len(index.entries))
+	}
+	index.entries = append(index.entries, &indexEntry{
+		Source:      source,
+		Translation: translation,
+		Tokens:      tokens,
+		Counts:      counts,
+	})
+}
+
+func (index *Index) Len() int {
+	return len(index.entries)
+}
+
+// Search returns the most similar indexed text
+func (index *Index) Search(text string) (*Match, bool) {
+	index.lock.Lock()
+	result, ok := index.results[text]
+	index.lock.Unlock()
+	if ok {
+		return result, result != nil
+	}
+
+	result = index.search(text)
+	index.lock.Lock()
+	index.results[text] = result
+	index.lock.Unlock()
+	return result, result != nil
+}
+
+func (index *Index) search(text string) *Match {
+	tokens := Tokenize(text)
+	counts := make(map[string]int)
+	for _, token := range tokens {
+		counts[token]++
+	}
+
+	// Tokens that a candidate shares with the text
+	shared := make(map[int]int)
+	for token, count := range counts {
+		for _, candidate := range index.postings[token] {
+			shared[candidate] += min(count, index.entries[candidate].Counts[token])
+		}
+	}
+
+	var best *Match
+	for candidate, sharedTokens := range shared {
+		entry := index.entries[candidate]
+		// Every token that is not shared needs at least one edit,
+		// so the shared tokens limit the similarity
+		longest := max(len(tokens), len(entry.Tokens))
+		if float64(sharedTokens)/float64(longest) < index.Threshold {
+			continue
+		}
+		similarity := Similarity(tokens, entry.Tokens)
+		if similarity < index.Threshold {
+			continue
+		}
+		if best == nil || similarity > best.Similarity || similarity == best.Similarity && entry.Source < best.Source {
+			best = &Match{
+				Source:      entry.Source,
+				Translation: entry.Translation,
+				Similarity:  similarity,
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,184 @@
+package memory
+
+import (
+	"bahmut.de/pdx-deepl/files"
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+const fileVersion = 1
+
+// Memory stores translations of source texts so that
+// the same text is only sent to a translation API once.
+// It is safe to use from multiple goroutines.
+type Memory struct {
+	Path string
+
+	lock    sync.RWMutex
+	entries map[Key]*Entry
+	changed bool
+}
+
+// Key identifies a translation in the memory
+type Key struct {
+	Backend        string
+	TargetLanguage string
+	Glossary       string
+	Source         string
+}
+
+type Entry struct {
+	Backend        string `json:"backend"`
+	TargetLanguage string `json:"target-language"`
+	Glossary       string `json:"glossary,omitempty"`
+	Source         string `json:"source"`
+	Translation    string `json:"translation"`
+}
+
+type memoryFile struct {
+	Version int      `json:"version"`
+	Entries []*Entry `json:"entries"`
+}
+
+func (entry *Entry) Key() Key {
+	return Key{
+		Backend:        entry.Backend,
+		TargetLanguage: entry.TargetLanguage,
+		Glossary:       entry.Glossary,
+		Source:         entry.Source,
+	}
+}
+
+// CreateMemory creates a memory that is not stored in a file
+func CreateMemory() *Memory {
+	return &Memory{
+		entries: make(map[Key]*Entry),
+	}
+}
+
+// ReadMemoryFile reads a memory file.
+// A file that does not exist yet results in an empty memory.
+func ReadMemoryFile(path string) (*Memory, error) {
+	memory := CreateMemory()
+	memory.Path = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return memory, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load translation memory: %s", err)
+	}
+
+	var content memoryFile
+	err = json.Unmarshal(data, &content)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse translation memory: %s", err)
+	}
+	if content.Version > fileVersion {
+		return nil, fmt.Errorf("unsupported translation memory version %d: %s", content.Version, path)
+	}
+	for _, entry := range content.Entries {
+		memory.entries[entry.Key()] = entry
+	}
+	return memory, nil
+}
+
+// Lookup returns the translation of the first backend that has one
+func (memory *Memory) Lookup(backends []string, targetLanguage, glossary, source string) (*Entry, bool) {
+	memory.lock.RLock()
+	defer memory.lock.RUnlock()
+	for _, backend := range backends {
+		entry, ok := memory.entries[Key{
+			Backend:        backend,
+			TargetLanguage: targetLanguage,
+			Glossary:       glossary,
+			Source:         source,
+		}]
+		if ok {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// Add stores a translation and replaces an existing one with the same key
+func (memory *Memory) Add(entry *Entry) {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+	memory.entries[entry.Key()] = entry
+	memory.changed = true
+}
+
+func (memory *Memory) Len() int {
+	memory.lock.RLock()
+	defer memory.lock.RUnlock()
+	return len(memory.entries)
+}
+
+// Save writes the memory to its file when it changed
+// and it was read from a file.
+// The entries are sorted so that the file can be compared and committed.
+func (memory *Memory) Save() error {
+	memory.lock.Lock()
+	defer memory.lock.Unlock()
+	if !memory.changed || memory.Path == "" {
+		return nil
+	}
+
+	content := memoryFile{
+		Version: fileVersion,
+		Entries: make([]*Entry, 0, len(memory.entries)),
+	}
+	for _, entry := range memory.entries {
+		content.Entries = append(content.Entries, entry)
+	}
+	slices.SortFunc(content.Entries, func(a, b *Entry) int {
+		return cmp.Or(
+			cmp.Compare(a.TargetLanguage, b.TargetLanguage),
+			cmp.Compare(a.Backend, b.Backend),
+			cmp.Compare(a.Glossary, b.Glossary),
+			cmp.Compare(a.Source, b.Source),
+		)
+	})
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if directory := filepath.Dir(memory.Path); directory != "" {
+		err = os.MkdirAll(directory, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	err = files.WriteAtomic(memory.Path, func(writer *bufio.Writer) {
+		writer.Write(data)
+	})
+	if err != nil {
+		return err
+	}
+	memory.changed = false
+	return nil
+}
+
+// Entries returns the translations into a target language
+func (memory *Memory) Entries(targetLanguage string) []*Entry {
+	memory.lock.RLock()
+	defer memory.lock.RUnlock()
+	entries := make([]*Entry, 0)
+	for _, entry := range memory.entries {
+		if entry.TargetLanguage == targetLanguage {
+			entries = append(entries, entry)
+		}
+	}
+	slices.SortFunc(entries, func(a, b *Entry) int {
+		return cmp.Or(cmp.Compare(a.Source, b.Source), cmp.Compare(a.Backend, b.Backend))
+	})
+	return entries
+}
@@ -0,0 +1,226 @@
+package openai
+
+import (
+	"bahmut.de/pdx-deepl/backend"
+	"bahmut.de/pdx-deepl/logging"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const BackendName = "openai"
+
+const EndpointChat = "chat/completions"
+
+// DefaultMaxAttempts is how often a text is sent to the model before it
+// is given up because protected tokens got lost or the request kept failing
+const DefaultMaxAttempts = 3
+
+// MaxRequestSize is the maximum size of one text in bytes
+const MaxRequestSize = 16 * 1024
+
+//go:embed prompt.tmpl
+var defaultPrompt string
+
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ChatRequest struct {
+	Model       string         `json:"model"`
+	Messages    []*ChatMessage `json:"messages"`
+	Temperature float64        `json:"temperature"`
+}
+
+type ChatResponse struct {
+	Choices []*ChatChoice `json:"choices"`
+}
+
+type ChatChoice struct {
+	Message *ChatMessage `json:"message"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// PromptData is available in the prompt template
+type PromptData struct {
+	SourceLanguage string
+	TargetLanguage string
+	Glossary       []*GlossaryTerm
+}
+
+type GlossaryTerm struct {
+	Source      string
+	Translation string
+}
+
+// Api is a client for any OpenAI compatible chat completions endpoint
+// like OpenAI itself, Ollama or a llama.cpp server
+type Api struct {
+	ApiUrl      *url.URL
+	Token       string
+	Model       string
+	Prompt      *template.Template
+	MaxAttempts int
+	// Timeout of a single request
+	Timeout time.Duration
+}
+
+func CreateApi(apiUrl *url.URL, token, model string) *Api {
+	return &Api{
+		ApiUrl:      apiUrl,
+		Token:       token,
+		Model:       model,
+		Prompt:      template.Must(template.New("prompt").Parse(defaultPrompt)),
+		MaxAttempts: DefaultMaxAttempts,
+		Timeout:     backend.DefaultTimeout,
+	}
+}
+
+// LoadPrompt replaces the default prompt with a template file
+func (api *Api) LoadPrompt(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not load prompt template: %s", err)
+	}
+	prompt, err := template.New("prompt").Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("could not parse prompt template: %s", err)
+	}
+	api.Prompt = prompt
+	return nil
+}
+
+func (api *Api) Name() string {
+	return BackendName
+}
+
+func (api *Api) Capabilities() backend.Capabilities {
+	return backend.Capabilities{
+		TagHandling:    true,
+		Glossary:       false,
+		MaxTexts:       1,
+		MaxRequestSize: MaxRequestSize,
+	}
+}
+
+// Usage reports an unlimited quota since chat
+// endpoints do not count characters
+func (api *Api) Usage(ctx context.Context) (*backend.Usage, error) {
+	return &backend.Usage{}, nil
+}
+
+func (api *Api) Translate(ctx context.Context, request *backend.Request) (*backend.Response, error) {
+	prompt, err := api.renderPrompt(request)
+	if err != nil {
+		return nil, err
+	}
+
+	translations := make([]string, len(request.Texts))
+	for i, text := range request.Texts {
+		translations[i], err = api.translateText(ctx, prompt, text, request.IgnoreTags)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &backend.Response{Translations: translations}, nil
+}
+
+// Translates a single text and validates that every protected
+// token survived. Texts with lost tokens are sent again.
+func (api *Api) translateText(ctx context.Context, prompt, text string, ignoreTags []string) (string, error) {
+	maxAttempts := max(api.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		translation, err := api.complete(ctx, prompt, text)
+		if err != nil {
+			return "", err
+		}
+		err = backend.VerifyTokens(text, translation, ignoreTags)
+		if err == nil {
+			return translation, nil
+		}
+		if attempt >= maxAttempts {
+			return "", err
+		}
+		logging.Debugf("Model response was rejected (attempt %d/%d): %s", attempt, maxAttempts, err)
+	}
+}
+
+func (api *Api) complete(ctx context.Context, prompt, text string) (string, error) {
+	requestBody, err := json.Marshal(ChatRequest{
+		Model: api.Model,
+		Messages: []*ChatMessage{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: text},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequest("POST", api.ApiUrl.JoinPath(EndpointChat).String(), bytes.NewReader(requestBody))
+	if err != nil {
+		return "", err
+	}
+	if api.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+api.Token)
+	}
+	body, err := backend.Send(ctx, api.Timeout, api.MaxAttempts, request, "OpenAI", errorMessage)
+	if err != nil {
+		return "", err
+	}
+
+	var chatResponse ChatResponse
+	err = json.Unmarshal(body, &chatResponse)
+	if err != nil {
+		return "", err
+	}
+	if len(chatResponse.Choices) == 0 || chatResponse.Choices[0].Message == nil {
+		return "", errors.New("model returned no answer")
+	}
+	return strings.TrimSpace(chatResponse.Choices[0].Message.Content), nil
+}
+
+func (api *Api) renderPrompt(request *backend.Request) (string, error) {
+	data := PromptData{
+		SourceLanguage: request.SourceLanguage.Name,
+		TargetLanguage: request.TargetLanguage.Name,
+		Glossary:       make([]*GlossaryTerm, 0, len(request.Terms)),
+	}
+	for source, translation := range request.Terms {
+		data.Glossary = append(data.Glossary, &GlossaryTerm{Source: source, Translation: translation})
+	}
+	sort.Slice(data.Glossary, func(i, j int) bool {
+		return data.Glossary[i].Source < data.Glossary[j].Source
+	})
+
+	var prompt strings.Builder
+	err := api.Prompt.Execute(&prompt, data)
+	if err != nil {
+		return "", fmt.Errorf("could not render prompt template: %s", err)
+	}
+	return prompt.String(), nil
+}
+
+func errorMessage(body []byte) string {
+	var message errorResponse
+	if json.Unmarshal(body, &message) != nil {
+		return ""
+	}
+	return message.Error.Message
+}
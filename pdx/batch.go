@@ -0,0 +1,54 @@
+package pdx
+
+import (
+	"encoding/json"
+)
+
+// requestOverhead is a generous estimate of the bytes a
+// translate request needs besides the texts themselves
+const requestOverhead = 1024
+
+type pendingLocalization struct {
+	Base    *Localization
+	Target  *Localization
+	Request string
+	// Missing is true when the key does not exist in the target file yet
+	Missing bool
+	// Retranslate is true when the translation memory and
+	// similar texts must not be used for the key
+	Retranslate bool
+}
+
+// Splits pending localizations into batches that respect
+// the maximum text count and request size of an api.
+// A single text larger than the size limit still gets its own batch
+// so that the api can report the problem for that key alone.
+func createBatches(pending []*pendingLocalization, maxTexts, maxSize int) [][]*pendingLocalization {
+	batches := make([][]*pendingLocalization, 0)
+	batch := make([]*pendingLocalization, 0, maxTexts)
+	batchSize := requestOverhead
+	for _, entry := range pending {
+		size := requestSize(entry.Request)
+		if len(batch) > 0 && (len(batch) >= maxTexts || batchSize+size > maxSize) {
+			batches = append(batches, batch)
+			batch = make([]*pendingLocalization, 0, maxTexts)
+			batchSize = requestOverhead
+		}
+		batch = append(batch, entry)
+		batchSize += size
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// Size of a text once it is encoded into a json request
+func requestSize(text string) int {
+	encoded, err := json.Marshal(text)
+	if err != nil {
+		return len(text) + 3
+	}
+	// Separating comma
+	return len(encoded) + 1
+}
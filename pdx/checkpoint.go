@@ -0,0 +1,37 @@
+package pdx
+
+import (
+	"time"
+)
+
+const DefaultCheckpointKeys = 250
+const DefaultCheckpointInterval = 5 * time.Minute
+
+// Decides when a target file is written while it is still translated
+type checkpoint struct {
+	keys     int
+	interval time.Duration
+	counter  int
+	last     time.Time
+}
+
+func (translator *ParadoxTranslator) createCheckpoint() *checkpoint {
+	return &checkpoint{
+		keys:     translator.CheckpointKeys,
+		interval: translator.CheckpointInterval,
+		last:     time.Now(),
+	}
+}
+
+// Adds the translated keys and reports whether a checkpoint is due.
+// The counter and timer are reset when it is.
+func (checkpoint *checkpoint) reached(keys int) bool {
+	checkpoint.counter += keys
+	due := checkpoint.keys > 0 && checkpoint.counter >= checkpoint.keys
+	due = due || checkpoint.interval > 0 && time.Since(checkpoint.last) >= checkpoint.interval
+	if due {
+		checkpoint.counter = 0
+		checkpoint.last = time.Now()
+	}
+	return due
+}
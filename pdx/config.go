@@ -12,14 +12,32 @@ type TranslationConfiguration struct {
 	BaseLanguage    string                              `json:"base-language"`
 	TargetLanguages []*TranslationConfigurationLanguage `json:"target-languages"`
 	IgnoreFiles     []string                            `json:"ignore-files"`
+	PriorityFiles   []string                            `json:"priority-files"`
+	Memory          string                              `json:"translation-memory"`
+	RenamedKeys     map[string]string                   `json:"renamed-keys"`
+	Backends        []*TranslationConfigurationBackend  `json:"backends"`
+	// NoByteOrderMark writes target files without a UTF-8 byte
+	// order mark, unless the base file has one
+	NoByteOrderMark bool `json:"no-byte-order-mark"`
 }
 
 type TranslationConfigurationLanguage struct {
-	Name     string `json:"name"`
-	Glossary string `json:"glossary"`
+	Name     string            `json:"name"`
+	Glossary string            `json:"glossary"`
+	Terms    map[string]string `json:"glossary-terms"`
 }
 
-func readConfigFile(path string) (*TranslationConfiguration, error) {
+// TranslationConfigurationBackend is one entry of the ordered
+// list of backends that are used when the previous one is exhausted
+type TranslationConfigurationBackend struct {
+	Type   string `json:"type"`
+	Url    string `json:"url"`
+	Token  string `json:"token"`
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+func ReadConfigFile(path string) (*TranslationConfiguration, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("could not load config file: %s", err)
@@ -35,5 +53,11 @@ func readConfigFile(path string) (*TranslationConfiguration, error) {
 		return nil, fmt.Errorf("no target languages found in config file: %s", path)
 	}
 
+	for i, configBackend := range translationConfiguration.Backends {
+		if configBackend.Type == "" {
+			return nil, fmt.Errorf("backend %d has no type in config file: %s", i+1, path)
+		}
+	}
+
 	return &translationConfiguration, nil
 }
@@ -0,0 +1,149 @@
+package pdx
+
+import (
+	"bahmut.de/pdx-deepl/files"
+	"bahmut.de/pdx-deepl/logging"
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var byteOrderMarkUTF16LE = []byte{0xFF, 0xFE}
+var byteOrderMarkUTF16BE = []byte{0xFE, 0xFF}
+
+// Characters of the bytes 0x80 to 0x9F in Windows-1252,
+// the other bytes are the same as in ISO 8859-1
+var windows1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// Checks that the content of a localization file is UTF-8.
+// UTF-16 can not be read and is an error.
+func checkEncoding(content []byte, file string) error {
+	if bytes.HasPrefix(content, byteOrderMarkUTF16LE) || bytes.HasPrefix(content, byteOrderMarkUTF16BE) {
+		return &ParseError{
+			File:    file,
+			Line:    1,
+			Column:  1,
+			Message: "file is encoded as UTF-16 instead of UTF-8 (convert it with -fix-encoding)",
+		}
+	}
+	return nil
+}
+
+// Warns about files that the game might not read. Target
+// files get a byte order mark when they are written.
+func (translator *ParadoxTranslator) warnEncoding(language *LocalizationLanguage, base bool) {
+	for _, file := range language.Files {
+		if file.InvalidEncoding {
+			logging.Warnf("Localization file is not valid UTF-8, use -fix-encoding to convert it: %s", file.Path)
+		}
+		if !file.ByteOrderMark && !translator.Config.NoByteOrderMark && base {
+			logging.Warnf("Localization file has no UTF-8 byte order mark and might be ignored by the game, use -fix-encoding to add it: %s", file.Path)
+		}
+	}
+}
+
+// Converts the content of a localization file to UTF-8 and adds the byte order mark
+// when requested, an existing one is kept. UTF-16 is decoded and bytes
+// that are not valid UTF-8 are read as Windows-1252.
+func fixEncoding(content []byte, addByteOrderMark bool) []byte {
+	var text string
+	hasByteOrderMark := bytes.HasPrefix(content, []byte(byteOrderMark)) ||
+		bytes.HasPrefix(content, byteOrderMarkUTF16LE) ||
+		bytes.HasPrefix(content, byteOrderMarkUTF16BE)
+	switch {
+	case bytes.HasPrefix(content, byteOrderMarkUTF16LE):
+		text = decodeUTF16(content[2:], func(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 })
+	case bytes.HasPrefix(content, byteOrderMarkUTF16BE):
+		text = decodeUTF16(content[2:], func(b []byte) uint16 { return uint16(b[0])<<8 | uint16(b[1]) })
+	case utf8.Valid(content):
+		text = string(content)
+	default:
+		text = decodeWindows1252(content)
+	}
+
+	text = strings.TrimLeft(text, byteOrderMark)
+	if addByteOrderMark || hasByteOrderMark {
+		text = byteOrderMark + text
+	}
+	return []byte(text)
+}
+
+func decodeUTF16(content []byte, decode func([]byte) uint16) string {
+	units := make([]uint16, 0, len(content)/2)
+	for i := 0; i+1 < len(content); i += 2 {
+		units = append(units, decode(content[i:i+2]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// Keeps valid UTF-8 sequences and reads the other bytes as Windows-1252
+func decodeWindows1252(content []byte) string {
+	var builder strings.Builder
+	builder.Grow(len(content))
+	for len(content) > 0 {
+		current, size := utf8.DecodeRune(content)
+		if current == utf8.RuneError && size == 1 {
+			current = rune(content[0])
+			if current >= 0x80 && current < 0xA0 {
+				current = windows1252[current-0x80]
+			}
+		}
+		builder.WriteRune(current)
+		content = content[size:]
+	}
+	return builder.String()
+}
+
+// FixEncoding converts the localization files of the base and
+// target languages to UTF-8 with a byte order mark (unless disabled).
+// Returns the number of files that were changed.
+func (translator *ParadoxTranslator) FixEncoding() (int, error) {
+	languages := []string{translator.Config.BaseLanguage}
+	for _, targetLanguageConfig := range translator.Config.TargetLanguages {
+		languages = append(languages, targetLanguageConfig.Name)
+	}
+
+	fixed := 0
+	for _, name := range languages {
+		languageDirectory := filepath.Join(translator.LocalizationDirectory, name)
+		if _, err := os.Stat(languageDirectory); os.IsNotExist(err) {
+			continue
+		}
+		err := filepath.WalkDir(languageDirectory, func(path string, info os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !strings.HasSuffix(path, ".yml") {
+				return nil
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			fixedContent := fixEncoding(content, !translator.Config.NoByteOrderMark)
+			if bytes.Equal(content, fixedContent) {
+				return nil
+			}
+			err = files.WriteAtomic(path, func(writer *bufio.Writer) {
+				writer.Write(fixedContent)
+			})
+			if err != nil {
+				return err
+			}
+			logging.Infof("%sFixed Encoding:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, path)
+			fixed++
+			return nil
+		})
+		if err != nil {
+			return fixed, err
+		}
+	}
+	return fixed, nil
+}
@@ -0,0 +1,159 @@
+package pdx
+
+import (
+	"bahmut.de/pdx-deepl/logging"
+	"bahmut.de/pdx-deepl/memory"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// reviewBackend marks drafts from fuzzy matches that
+// have to be reviewed, e.g. #deepl:<checksum>:review
+const reviewBackend = "review"
+
+const DefaultFuzzyThreshold = 0.85
+
+// FuzzyMatch is the translation of a similar text that
+// was found for a pending localization key
+type FuzzyMatch struct {
+	Language   string
+	FileName   string
+	Key        string
+	Text       string
+	Source     string
+	Suggestion string
+	Similarity float64
+}
+
+// Indexes the translations of every target language for fuzzy matching.
+// Translations come from the translation memory and from
+// up to date or manual localizations of the target files.
+func (translator *ParadoxTranslator) createFuzzyIndexes() {
+	translator.fuzzyIndexes = make(map[*LocalizationLanguage]*memory.Index)
+	for _, targetLanguage := range translator.TargetLanguages {
+		index := memory.CreateIndex(translator.FuzzyThreshold)
+		if translator.Memory != nil {
+			for _, entry := range translator.Memory.Entries(targetLanguage.Name) {
+				index.Add(entry.Source, entry.Translation)
+			}
+		}
+
+		fileKeys := make([]string, 0, len(targetLanguage.Files))
+		for key := range targetLanguage.Files {
+			fileKeys = append(fileKeys, key)
+		}
+		slices.Sort(fileKeys)
+		for _, fileKey := range fileKeys {
+			baseFile, ok := translator.BaseLanguage.Files[fileKey]
+			if !ok {
+				continue
+			}
+			targetFile := targetLanguage.Files[fileKey]
+			keys := make([]string, 0, len(targetFile.Localizations))
+			for key := range targetFile.Localizations {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			for _, key := range keys {
+				localization := targetFile.Localizations[key]
+				baseLocalization, ok := baseFile.Localizations[key]
+				if !ok || localization.Backend == reviewBackend {
+					continue
+				}
+				if localization.CompareChecksum == 0 || localization.CompareChecksum == baseLocalization.Checksum {
+					index.Add(baseLocalization.Text, localization.Text)
+				}
+			}
+		}
+		logging.Debugf("%sFuzzy Index:%s %s with %d texts", logging.AnsiBoldOn, logging.AnsiAllDefault, targetLanguage.Name, index.Len())
+		translator.fuzzyIndexes[targetLanguage] = index
+	}
+}
+
+// Finds the fuzzy matches of the pending localizations.
+// With drafts enabled the matched localizations are not translated.
+func (translator *ParadoxTranslator) splitFuzzy(
+	pending []*pendingLocalization,
+	targetLanguage *LocalizationLanguage,
+) (remaining []*pendingLocalization, matches map[*pendingLocalization]*memory.Match) {
+	matches = make(map[*pendingLocalization]*memory.Match)
+	index := translator.fuzzyIndexes[targetLanguage]
+	if index == nil {
+		return pending, matches
+	}
+	remaining = make([]*pendingLocalization, 0, len(pending))
+	for _, entry := range pending {
+		if entry.Retranslate {
+			remaining = append(remaining, entry)
+			continue
+		}
+		match, ok := index.Search(entry.Base.Text)
+		if ok {
+			matches[entry] = match
+		}
+		if !ok || !translator.FuzzyDrafts {
+			remaining = append(remaining, entry)
+		}
+	}
+	return remaining, matches
+}
+
+func (translator *ParadoxTranslator) addFuzzyMatch(targetLanguage *LocalizationLanguage, fileName string, entry *pendingLocalization, match *memory.Match) {
+	translator.pendingLock.Lock()
+	defer translator.pendingLock.Unlock()
+	translator.FuzzyMatches = append(translator.FuzzyMatches, &FuzzyMatch{
+		Language:   targetLanguage.Name,
+		FileName:   fileName,
+		Key:        entry.Base.Key,
+		Text:       entry.Base.Text,
+		Source:     match.Source,
+		Suggestion: match.Translation,
+		Similarity: match.Similarity,
+	})
+}
+
+// WriteFuzzyReport writes the fuzzy matches as a CSV file
+func WriteFuzzyReport(path string, matches []*FuzzyMatch) error {
+	matches = slices.Clone(matches)
+	slices.SortFunc(matches, func(a, b *FuzzyMatch) int {
+		if a.Language != b.Language {
+			return strings.Compare(a.Language, b.Language)
+		}
+		if a.FileName != b.FileName {
+			return strings.Compare(a.FileName, b.FileName)
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create fuzzy report: %s", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	err = writer.Write([]string{"language", "file", "key", "similarity", "text", "source", "suggestion"})
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		err = writer.Write([]string{
+			match.Language,
+			match.FileName,
+			match.Key,
+			strconv.FormatFloat(match.Similarity, 'f', 2, 64),
+			match.Text,
+			match.Source,
+			match.Suggestion,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
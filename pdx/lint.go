@@ -0,0 +1,126 @@
+package pdx
+
+import (
+	"bahmut.de/pdx-deepl/logging"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Lint checks the base and target localization files and reports
+// every problem as a warning. Returns the number of problems.
+func (translator *ParadoxTranslator) Lint() (int, error) {
+	languages := []string{translator.Config.BaseLanguage}
+	for _, targetLanguageConfig := range translator.Config.TargetLanguages {
+		languages = append(languages, targetLanguageConfig.Name)
+	}
+
+	problems := 0
+	for i, name := range languages {
+		if _, err := os.Stat(filepath.Join(translator.LocalizationDirectory, name)); i > 0 && os.IsNotExist(err) {
+			// Target languages are created by the translation
+			continue
+		}
+		language, err := readLanguage(translator.LocalizationDirectory, name)
+		var parseError *ParseError
+		if errors.As(err, &parseError) {
+			// The files of the language can not be read until it is fixed
+			logging.Warnf("%s", parseError.Error())
+			problems++
+			continue
+		}
+		if err != nil {
+			return problems, err
+		}
+		count, err := lintLanguage(language, !translator.Config.NoByteOrderMark)
+		if err != nil {
+			return problems, err
+		}
+		logging.Infof("%sLinted Language:%s %s with %d problems", logging.AnsiBoldOn, logging.AnsiAllDefault, language.Name, count)
+		problems += count
+	}
+	return problems, nil
+}
+
+func lintLanguage(language *LocalizationLanguage, byteOrderMark bool) (int, error) {
+	problems := make([]*ParseError, 0)
+	// First line of every key in the language, to find duplicates across files
+	seen := make(map[string]*ParseError)
+	for _, fileKey := range slices.Sorted(maps.Keys(language.Files)) {
+		file := language.Files[fileKey]
+		content, err := os.ReadFile(file.Path)
+		if err != nil {
+			return 0, err
+		}
+		document, parseErrors := ParseDocument(string(content))
+		for _, parseError := range parseErrors {
+			parseError.File = file.Path
+		}
+		problems = append(problems, parseErrors...)
+		if byteOrderMark && !document.ByteOrderMark {
+			problems = append(problems, &ParseError{File: file.Path, Line: 1, Column: 1, Message: "missing UTF-8 byte order mark"})
+		}
+		if file.InvalidEncoding {
+			problems = append(problems, &ParseError{File: file.Path, Line: 1, Column: 1, Message: "file is not valid UTF-8"})
+		}
+
+		problem := func(line *Line, format string, arguments ...any) *ParseError {
+			return &ParseError{
+				File:    file.Path,
+				Line:    line.Number,
+				Column:  len([]rune(line.Indent)) + 1,
+				Message: fmt.Sprintf(format, arguments...),
+			}
+		}
+
+		header := false
+		for _, line := range document.Lines {
+			switch line.Kind {
+			case LineHeader:
+				if header {
+					problems = append(problems, problem(line, "more than one language header"))
+				} else if line.Language != language.Name {
+					problems = append(problems, problem(line, "language header l_%s: does not match language %s", line.Language, language.Name))
+				}
+				header = true
+			case LineEntry:
+				if !header {
+					problems = append(problems, problem(line, "localization key %q before the language header l_%s:", line.Key, language.Name))
+					header = true
+				}
+				if line.Marker != "" {
+					if _, _, err := parseMarker(line.Marker); err != nil {
+						problems = append(problems, problem(line, "invalid marker %q of localization key %q", line.Marker, line.Key))
+					}
+				}
+				current := problem(line, "duplicate localization key %q", line.Key)
+				if first, ok := seen[line.Key]; ok {
+					current.Message = fmt.Sprintf("duplicate localization key %q, first defined at %s:%d", line.Key, first.File, first.Line)
+					problems = append(problems, current)
+					continue
+				}
+				seen[line.Key] = current
+			}
+		}
+		if !header {
+			problems = append(problems, &ParseError{File: file.Path, Line: 1, Column: 1, Message: fmt.Sprintf("missing language header l_%s:", language.Name)})
+		}
+	}
+
+	for _, problem := range problems {
+		logging.Warnf("%s", problem.Error())
+	}
+	return len(problems), nil
+}
+
+// Warns about the lines of a language that could not be parsed
+func warnParseErrors(language *LocalizationLanguage) {
+	for _, fileKey := range slices.Sorted(maps.Keys(language.Files)) {
+		for _, parseError := range language.Files[fileKey].Errors {
+			logging.Warnf("Skipped invalid line %s", parseError.Error())
+		}
+	}
+}
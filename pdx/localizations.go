@@ -1,22 +1,25 @@
 package pdx
 
 import (
+	"bahmut.de/pdx-deepl/files"
 	"bahmut.de/pdx-deepl/logging"
 	"bufio"
 	"fmt"
 	"hash/crc32"
-	"log"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 const skippedHash = "skipped"
 const skippedChecksum = 1
 
-var regexLocalization = regexp.MustCompile(`^\s*(?P<locKey>.+):\d*\s*"(?P<loc>.*)"\s*(?P<hash>#deepl:.*)?(?:#.*)?$`)
+// Localizations marked without a backend
+// were translated by this backend
+const defaultBackend = "deepl"
+
 var crc32q = crc32.MakeTable(0xD5828281)
 
 type LocalizationLanguage struct {
@@ -31,19 +34,32 @@ type LocalizationFile struct {
 	FileName      string
 	Path          string
 	Localizations map[string]*Localization
+	// Errors of lines that could not be parsed
+	Errors []*ParseError
+	// ByteOrderMark is true when the file starts with a UTF-8 byte order mark
+	ByteOrderMark bool
+	// InvalidEncoding is true when the file is not valid UTF-8
+	InvalidEncoding bool
 }
 
 type Localization struct {
 	Key             string
+	Version         string
 	Text            string
 	Checksum        uint32
 	CompareChecksum uint32
+	// Backend that produced the translation
+	Backend string
 }
 
+// WriteFile writes the target file with the structure of the base file.
+// Lines of the existing target file that are not in the base file are kept,
+// keys of them only when keep returns true.
 func (file *LocalizationFile) WriteFile(
 	baseFile *LocalizationFile,
 	baseLanguage *LocalizationLanguage,
 	targetLanguage *LocalizationLanguage,
+	keep func(key string) bool,
 ) error {
 	// Create target language directories
 	if _, err := os.Stat(filepath.Dir(file.Path)); os.IsNotExist(err) {
@@ -58,59 +74,20 @@ func (file *LocalizationFile) WriteFile(
 	if err != nil {
 		return err
 	}
-	targetContent := string(baseContent)
-
-	// Replace language Tag
-	targetContent = strings.Replace(
-		targetContent,
-		"l_"+baseLanguage.Name+":",
-		"l_"+targetLanguage.Name+":",
-		1,
-	)
-
-	keys := make([]string, 0, len(file.Localizations))
-	for key := range file.Localizations {
-		keys = append(keys, key)
-	}
-
-	// Replace relevant lines
-	for line := range strings.Lines(targetContent) {
-		for _, key := range keys {
-			matches := findAll(regexLocalization, line)
-			localization := file.Localizations[key]
-			if matches["locKey"] != key {
-				continue
-			}
-			var lineBuilder strings.Builder
-			lineBuilder.WriteString(" ")
-			lineBuilder.WriteString(localization.Key)
-			lineBuilder.WriteString(": \"")
-			lineBuilder.WriteString(localization.Text)
-			lineBuilder.WriteString("\"")
-			if localization.CompareChecksum == skippedChecksum {
-				lineBuilder.WriteString(" #deepl:")
-				lineBuilder.WriteString(skippedHash)
-			} else if localization.CompareChecksum != 0 {
-				lineBuilder.WriteString(" #deepl:")
-				lineBuilder.WriteString(strconv.Itoa(int(localization.CompareChecksum)))
-			}
-			if strings.HasSuffix(line, "\r\n") {
-				lineBuilder.WriteString("\r\n")
-			} else {
-				lineBuilder.WriteString("\n")
-			}
+	document, _ := ParseDocument(string(baseContent))
 
-			targetContent = strings.Replace(
-				targetContent,
-				line,
-				lineBuilder.String(),
-				1,
-			)
-			break
-		}
+	// Read the existing target file to keep its own lines
+	var targetDocument *Document
+	targetContent, err := os.ReadFile(file.Path)
+	if err == nil {
+		targetDocument, _ = ParseDocument(string(targetContent))
+	} else if !os.IsNotExist(err) {
+		return err
 	}
 
-	return os.WriteFile(file.Path, []byte(targetContent), 0644)
+	return files.WriteAtomic(file.Path, func(writer *bufio.Writer) {
+		file.writeLines(writer, document, targetDocument, keep, baseFile, baseLanguage, targetLanguage)
+	})
 }
 
 func readLanguage(localizationDirectory string, name string) (*LocalizationLanguage, error) {
@@ -136,7 +113,7 @@ func readLanguage(localizationDirectory string, name string) (*LocalizationLangu
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
+		if info.IsDir() || filepath.Ext(path) != ".yml" {
 			return nil
 		}
 		localization, err := readLocalizationFile(path, &language)
@@ -156,14 +133,18 @@ func readLanguage(localizationDirectory string, name string) (*LocalizationLangu
 	})
 
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	return &language, nil
 }
 
 func readLocalizationFile(file string, language *LocalizationLanguage) (*LocalizationFile, error) {
-	reader, err := os.Open(file)
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	err = checkEncoding(content, file)
 	if err != nil {
 		return nil, err
 	}
@@ -176,28 +157,31 @@ func readLocalizationFile(file string, language *LocalizationLanguage) (*Localiz
 		Localizations: make(map[string]*Localization),
 	}
 
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		line := scanner.Text()
-		matches := findAll(regexLocalization, line)
-		checksum := crc32.Checksum([]byte(matches["loc"]), crc32q)
-		if len(matches) == 0 {
-			// skip line when there is no valid localization
+	document, parseErrors := ParseDocument(string(content))
+	for _, parseError := range parseErrors {
+		parseError.File = file
+	}
+	localizationFile.Errors = parseErrors
+	localizationFile.ByteOrderMark = document.ByteOrderMark
+	localizationFile.InvalidEncoding = !utf8.Valid(content)
+
+	for _, line := range document.Lines {
+		if line.Kind != LineEntry {
 			continue
 		}
-
 		localization := &Localization{
-			Key:      matches["locKey"],
-			Text:     matches["loc"],
-			Checksum: checksum,
+			Key:      line.Key,
+			Version:  line.Version,
+			Text:     line.Text,
+			Checksum: crc32.Checksum([]byte(line.Text), crc32q),
 		}
-		if matches["hash"] != "" && !strings.Contains(matches["hash"], "#deepl:"+skippedHash) {
-			pureHash, _ := strings.CutPrefix(matches["hash"], "#deepl:")
-			checksum, err := strconv.Atoi(pureHash)
+		if line.Marker != "" {
+			checksum, backendName, err := parseMarker(line.Marker)
 			if err == nil {
-				localization.CompareChecksum = uint32(checksum)
+				localization.CompareChecksum = checksum
+				localization.Backend = backendName
 			} else {
-				logging.Warnf("Could not parse existsing compare checksum (%s) in file: %s", matches["hash"], file)
+				logging.Warnf("Could not parse existsing compare checksum (%s) in file: %s", line.Marker, file)
 			}
 		}
 		localizationFile.Localizations[localization.Key] = localization
@@ -211,13 +195,121 @@ func readLocalizationFile(file string, language *LocalizationLanguage) (*Localiz
 	return localizationFile, nil
 }
 
-func findAll(expression *regexp.Regexp, content string) (matches map[string]string) {
-	match := expression.FindStringSubmatch(content)
-	matches = make(map[string]string)
-	for i, name := range expression.SubexpNames() {
-		if i > 0 && i <= len(match) {
-			matches[name] = match[i]
+// Parses a marker e.g. #deepl:<checksum>[:<backend>] or #deepl:skipped
+func parseMarker(marker string) (uint32, string, error) {
+	value, _ := strings.CutPrefix(marker, markerPrefix)
+	if value == skippedHash {
+		// Skipped keys are translated in the next run
+		return skippedChecksum, "", nil
+	}
+	value, backendName, _ := strings.Cut(value, ":")
+	checksum, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, "", err
+	}
+	return uint32(checksum), backendName, nil
+}
+
+// Renders the merged lines of a target file in one pass.
+// Errors are kept by the writer and returned by its Flush.
+func (file *LocalizationFile) writeLines(
+	writer *bufio.Writer,
+	document *Document,
+	targetDocument *Document,
+	keep func(key string) bool,
+	baseFile *LocalizationFile,
+	baseLanguage *LocalizationLanguage,
+	targetLanguage *LocalizationLanguage,
+) {
+	lineEnding := "\n"
+	for _, line := range document.Lines {
+		if line.Ending != "" {
+			lineEnding = line.Ending
+			break
+		}
+	}
+
+	// Comments that were added to the keys in the target file
+	targetComments := make(map[string]string)
+	if targetDocument != nil {
+		for _, line := range targetDocument.Lines {
+			if line.Kind == LineEntry && line.Comment != "" {
+				targetComments[line.Key] = line.Comment
+			}
+		}
+	}
+
+	lines := mergeDocuments(document, targetDocument, keep)
+	if file.ByteOrderMark {
+		writer.WriteString(byteOrderMark)
+	}
+	header := false
+	for i, line := range lines {
+		switch {
+		case line.Kind == LineHeader && line.Language == baseLanguage.Name && !header:
+			// Replace language Tag
+			header = true
+			tag := "l_" + baseLanguage.Name + ":"
+			index := strings.Index(line.Raw, tag)
+			writer.WriteString(validText(line.Raw[:index]))
+			writer.WriteString("l_" + targetLanguage.Name + ":")
+			writer.WriteString(validText(line.Raw[index+len(tag):]))
+		case line.Kind == LineEntry && baseFile.Localizations[line.Key] != nil && file.Localizations[line.Key] != nil:
+			localization := file.Localizations[line.Key]
+			version := localization.Version
+			if version == "" {
+				// Keep the version number of the base language
+				version = line.Version
+			}
+			comment, ok := targetComments[line.Key]
+			if !ok {
+				comment = line.Comment
+			}
+			writeEntry(writer, localization, version, comment)
+		default:
+			writer.WriteString(validText(line.Raw))
+		}
+		if line.Ending == "" && i < len(lines)-1 {
+			writer.WriteString(lineEnding)
+		} else {
+			writer.WriteString(line.Ending)
+		}
+	}
+}
+
+// Replaces the bytes of a text that are not valid UTF-8,
+// so that target files are always valid UTF-8
+func validText(text string) string {
+	if utf8.ValidString(text) {
+		return text
+	}
+	return strings.ToValidUTF8(text, "\uFFFD")
+}
+
+// Writes the line of a localization in a target file without line ending
+func writeEntry(writer *bufio.Writer, localization *Localization, version string, comment string) {
+	writer.WriteString(" ")
+	writer.WriteString(localization.Key)
+	writer.WriteString(":")
+	writer.WriteString(version)
+	writer.WriteString(" \"")
+	writer.WriteString(validText(localization.Text))
+	writer.WriteString("\"")
+	if localization.CompareChecksum == skippedChecksum {
+		writer.WriteString(" ")
+		writer.WriteString(markerPrefix)
+		writer.WriteString(skippedHash)
+	} else if localization.CompareChecksum != 0 {
+		writer.WriteString(" ")
+		writer.WriteString(markerPrefix)
+		writer.WriteString(strconv.FormatUint(uint64(localization.CompareChecksum), 10))
+		if localization.Backend != "" && localization.Backend != defaultBackend {
+			writer.WriteString(":")
+			writer.WriteString(localization.Backend)
 		}
 	}
-	return matches
+	if comment != "" {
+		writer.WriteString(" ")
+		writer.WriteString(validText(comment))
+	}
 }
@@ -0,0 +1,212 @@
+package pdx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var testBaseLanguage = &LocalizationLanguage{Name: "english"}
+var testTargetLanguage = &LocalizationLanguage{Name: "german"}
+
+func keepAll(string) bool {
+	return true
+}
+
+// Writes a base and target file and reads them like the translator does
+func createTestFiles(t testing.TB, baseContent, targetContent string) (baseFile, targetFile *LocalizationFile) {
+	directory := t.TempDir()
+	basePath := filepath.Join(directory, "test_l_english.yml")
+	targetPath := filepath.Join(directory, "test_l_german.yml")
+	err := os.WriteFile(basePath, []byte(baseContent), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	language := &LocalizationLanguage{Name: "english", Directory: directory}
+	baseFile, err = readLocalizationFile(basePath, language)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targetContent == "" {
+		return baseFile, &LocalizationFile{Path: targetPath, Localizations: make(map[string]*Localization)}
+	}
+	err = os.WriteFile(targetPath, []byte(targetContent), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetFile, err = readLocalizationFile(targetPath, language)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return baseFile, targetFile
+}
+
+func writeTestFile(t testing.TB, baseFile, targetFile *LocalizationFile) string {
+	err := targetFile.WriteFile(baseFile, testBaseLanguage, testTargetLanguage, keepAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(targetFile.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestWriteFileKeepsComments(t *testing.T) {
+	baseFile, targetFile := createTestFiles(t,
+		"l_english:\n key_a:0 \"Hello World\"\n key_b: \"Second\" # base note\n",
+		"l_german:\n key_a:0 \"Hallo Welt (manuell)\" # translator note\n key_b: \"Zweite\" #deepl:12345 # check \"this\"\n",
+	)
+	want := "l_german:\n key_a:0 \"Hallo Welt (manuell)\" # translator note\n key_b: \"Zweite\" #deepl:12345 # check \"this\"\n"
+	if content := writeTestFile(t, baseFile, targetFile); content != want {
+		t.Errorf("got\n%s\nwant\n%s", content, want)
+	}
+}
+
+func TestReadLanguageSkipsTemporaryFiles(t *testing.T) {
+	directory := t.TempDir()
+	languageDirectory := filepath.Join(directory, "german")
+	err := os.MkdirAll(languageDirectory, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(languageDirectory, "test_l_german.yml"), []byte("l_german:\n key: \"Hallo\"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Left over by a crash while writing
+	err = os.WriteFile(filepath.Join(languageDirectory, "test_l_german.yml.tmp"), []byte("l_german:\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	language, err := readLanguage(directory, "german")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(language.Files) != 1 || language.Files["test_"] == nil {
+		t.Errorf("got files %v, want only test_", language.Files)
+	}
+}
+
+func TestWriteFileIdenticalLines(t *testing.T) {
+	baseFile, targetFile := createTestFiles(t,
+		"l_english:\n key_a: \"Same\"\n key_b: \"Other\"\n key_a: \"Same\"\n",
+		"",
+	)
+	targetFile.Localizations["key_a"] = &Localization{Key: "key_a", Text: "Gleich", CompareChecksum: 12345}
+	targetFile.Localizations["key_b"] = &Localization{Key: "key_b", Text: "Anders", CompareChecksum: 23456}
+	want := "l_german:\n key_a: \"Gleich\" #deepl:12345\n key_b: \"Anders\" #deepl:23456\n key_a: \"Gleich\" #deepl:12345\n"
+	if content := writeTestFile(t, baseFile, targetFile); content != want {
+		t.Errorf("got\n%s\nwant\n%s", content, want)
+	}
+
+	// Identical lines of different keys are rendered from their own key
+	baseFile, targetFile = createTestFiles(t,
+		"l_english:\n key_a: \"Same\"\n key_b: \"Same\"\n",
+		"",
+	)
+	targetFile.Localizations["key_a"] = &Localization{Key: "key_a", Text: "Erste", CompareChecksum: 12345}
+	targetFile.Localizations["key_b"] = &Localization{Key: "key_b", Text: "Zweite", CompareChecksum: 12345}
+	want = "l_german:\n key_a: \"Erste\" #deepl:12345\n key_b: \"Zweite\" #deepl:12345\n"
+	if content := writeTestFile(t, baseFile, targetFile); content != want {
+		t.Errorf("got\n%s\nwant\n%s", content, want)
+	}
+}
+
+// Generates a base and a translated target file with the number of lines
+func generateTestContent(lines int) (baseContent, targetContent string) {
+	var base, target strings.Builder
+	base.WriteString(byteOrderMark + "l_english:\n")
+	target.WriteString(byteOrderMark + "l_german:\n")
+	for i := 0; i < lines; i++ {
+		if i%50 == 0 {
+			base.WriteString(" # Section\n\n")
+			target.WriteString(" # Section\n\n")
+		}
+		fmt.Fprintf(&base, " key_%d:0 \"Text number %d with [ROOT.GetName] and $ref_%d$\"\n", i, i, i)
+		fmt.Fprintf(&target, " key_%d:0 \"Text Nummer %d mit [ROOT.GetName] und $ref_%d$\" #deepl:12345\n", i, i, i)
+	}
+	return base.String(), target.String()
+}
+
+func BenchmarkWriteFile(b *testing.B) {
+	for _, lines := range []int{1000, 10000, 50000} {
+		b.Run(strconv.Itoa(lines), func(b *testing.B) {
+			baseContent, targetContent := generateTestContent(lines)
+			baseFile, targetFile := createTestFiles(b, baseContent, targetContent)
+			for b.Loop() {
+				err := targetFile.WriteFile(baseFile, testBaseLanguage, testTargetLanguage, keepAll)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadLanguageRejectsUTF16(t *testing.T) {
+	directory := t.TempDir()
+	languageDirectory := filepath.Join(directory, "english")
+	err := os.MkdirAll(languageDirectory, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := append([]byte{0xFF, 0xFE}, []byte("l\x00_\x00")...)
+	err = os.WriteFile(filepath.Join(languageDirectory, "test_l_english.yml"), content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = readLanguage(directory, "english")
+	var parseError *ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("got error %v, want a parse error", err)
+	}
+
+	config := &TranslationConfiguration{BaseLanguage: "english", TargetLanguages: []*TranslationConfigurationLanguage{{Name: "german"}}}
+	translator, err := CreateTranslator(config, directory, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err := translator.Lint()
+	if err != nil || problems != 1 {
+		t.Errorf("lint found %d problems with error %v, want 1 problem", problems, err)
+	}
+}
+
+func TestWriteFileEditedBaseComments(t *testing.T) {
+	target := ""
+	for _, section := range []string{"A", "Alpha", "Beta"} {
+		baseFile, targetFile := createTestFiles(t,
+			"l_english:\n # Section "+section+"\n key_a: \"Hello\"\n\n # Economy\n key_b: \"World\"\n",
+			target,
+		)
+		targetFile.Localizations["key_a"] = &Localization{Key: "key_a", Text: "Hallo", CompareChecksum: 12345}
+		targetFile.Localizations["key_b"] = &Localization{Key: "key_b", Text: "Welt", CompareChecksum: 23456}
+		target = writeTestFile(t, baseFile, targetFile)
+		if section == "A" {
+			// Added by a translator
+			target = strings.Replace(target, " # Economy\n", " # Economy\n # Wirtschaft, check the terms\n", 1)
+		}
+	}
+	want := "l_german:\n # Section Beta\n key_a: \"Hallo\" #deepl:12345\n\n # Economy\n # Wirtschaft, check the terms\n key_b: \"Welt\" #deepl:23456\n"
+	if target != want {
+		t.Errorf("got\n%s\nwant\n%s", target, want)
+	}
+
+	// A translator comment at the place of a new base comment is kept
+	baseFile, targetFile := createTestFiles(t,
+		"l_english:\n key_a: \"Hello\"\n # New section\n key_b: \"World\"\n",
+		"l_german:\n key_a: \"Hallo\" #deepl:12345\n # Note of the translator\n key_b: \"Welt\" #deepl:23456\n",
+	)
+	want = "l_german:\n key_a: \"Hallo\" #deepl:12345\n # New section\n # Note of the translator\n key_b: \"Welt\" #deepl:23456\n"
+	if content := writeTestFile(t, baseFile, targetFile); content != want {
+		t.Errorf("got\n%s\nwant\n%s", content, want)
+	}
+}
@@ -0,0 +1,74 @@
+package pdx
+
+import (
+	"bahmut.de/pdx-deepl/backend"
+	"bahmut.de/pdx-deepl/memory"
+)
+
+// translation is the result for one localization of a batch
+type translation struct {
+	Text    string
+	Backend string
+	// Remembered is true when the translation
+	// came from the translation memory
+	Remembered bool
+}
+
+// Glossary id that is sent with the requests of a language
+func (translator *ParadoxTranslator) requestGlossary(languageConfig *TranslationConfigurationLanguage) string {
+	if !translator.Backend.Capabilities().Glossary {
+		return ""
+	}
+	return languageConfig.Glossary
+}
+
+// Looks up a text in the translation memory.
+// Translations of every backend that may answer a request are accepted.
+func (translator *ParadoxTranslator) lookupMemory(
+	source string,
+	targetLanguage *LocalizationLanguage,
+	glossary string,
+) (*memory.Entry, bool) {
+	if translator.Memory == nil {
+		return nil, false
+	}
+	return translator.Memory.Lookup(backend.Names(translator.Backend), targetLanguage.Name, glossary, source)
+}
+
+func (translator *ParadoxTranslator) remember(
+	source string,
+	targetLanguage *LocalizationLanguage,
+	glossary string,
+	result *translation,
+) {
+	if translator.Memory == nil {
+		return
+	}
+	translator.Memory.Add(&memory.Entry{
+		Backend:        result.Backend,
+		TargetLanguage: targetLanguage.Name,
+		Glossary:       glossary,
+		Source:         source,
+		Translation:    result.Text,
+	})
+}
+
+// Splits the pending localizations into the ones that still have to be
+// translated and the ones with a translation in the translation memory
+func (translator *ParadoxTranslator) splitRemembered(
+	pending []*pendingLocalization,
+	targetLanguage *LocalizationLanguage,
+	glossary string,
+) (remaining []*pendingLocalization, remembered map[*pendingLocalization]*memory.Entry) {
+	remaining = make([]*pendingLocalization, 0, len(pending))
+	remembered = make(map[*pendingLocalization]*memory.Entry)
+	for _, entry := range pending {
+		found, ok := translator.lookupMemory(entry.Base.Text, targetLanguage, glossary)
+		if !ok || entry.Retranslate {
+			remaining = append(remaining, entry)
+			continue
+		}
+		remembered[entry] = found
+	}
+	return remaining, remembered
+}
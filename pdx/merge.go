@@ -0,0 +1,297 @@
+package pdx
+
+import (
+	"bahmut.de/pdx-deepl/logging"
+	"bahmut.de/pdx-deepl/memory"
+	"maps"
+	"slices"
+)
+
+const (
+	OrphansKeep   = "keep"
+	OrphansReport = "report"
+	OrphansPrune  = "prune"
+)
+
+var OrphanPolicies = []string{OrphansKeep, OrphansReport, OrphansPrune}
+
+// Anchor of the lines after the language header.
+// The empty anchor is the start of the file.
+const headerAnchor = ":"
+
+// Maximum size of the table that compares the lines of
+// a base and target gap that differ, about 32 MB
+const maxMergeCells = 4 * 1024 * 1024
+
+// Minimum similarity of a target line to a changed
+// base line to be treated as an older version of it
+const editedSimilarity = 0.5
+
+// Merges the lines of an existing target document into the base document.
+// The order and structure of the base document is kept. Lines that only exist
+// in the target document, like comments, blank lines or keys that are not in the
+// base document, stay after the last key that both documents share.
+// Keys only in the target document are dropped when keep returns false.
+func mergeDocuments(base, target *Document, keep func(key string) bool) []*Line {
+	baseKeys := make(map[string]bool)
+	for _, line := range base.Lines {
+		if line.Kind == LineEntry {
+			baseKeys[line.Key] = true
+		}
+	}
+
+	targetGaps := make(map[string][]*Line)
+	anchors := make([]string, 0)
+	if target != nil {
+		anchor := ""
+		for _, line := range target.Lines {
+			switch {
+			case line.Kind == LineHeader:
+				anchor = headerAnchor
+				continue
+			case line.Kind == LineEntry && baseKeys[line.Key]:
+				anchor = line.Key
+				continue
+			case line.Kind == LineEntry && !keep(line.Key):
+				continue
+			}
+			if _, ok := targetGaps[anchor]; !ok {
+				anchors = append(anchors, anchor)
+			}
+			targetGaps[anchor] = append(targetGaps[anchor], line)
+		}
+	}
+
+	merged := make([]*Line, 0, len(base.Lines))
+	anchor := ""
+	gap := make([]*Line, 0)
+	flush := func() {
+		merged = append(merged, mergeGap(gap, targetGaps[anchor])...)
+		delete(targetGaps, anchor)
+		gap = gap[:0]
+	}
+	for _, line := range base.Lines {
+		if line.Kind != LineHeader && line.Kind != LineEntry {
+			gap = append(gap, line)
+			continue
+		}
+		flush()
+		merged = append(merged, line)
+		anchor = line.Key
+		if line.Kind == LineHeader {
+			anchor = headerAnchor
+		}
+	}
+	flush()
+
+	// Lines after a header that the base document does not have
+	for _, anchor := range anchors {
+		merged = append(merged, targetGaps[anchor]...)
+	}
+	return merged
+}
+
+// Merges the lines between two keys of the base and target document.
+// Lines in both are only kept once, lines of the base come first.
+func mergeGap(base, target []*Line) []*Line {
+	if len(target) == 0 {
+		return slices.Clone(base)
+	}
+
+	// Lines at the start and end that are the same in both are
+	// merged right away, usually the gaps are the same as a whole
+	prefix := 0
+	for prefix < len(base) && prefix < len(target) && base[prefix].Raw == target[prefix].Raw {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(base)-prefix && suffix < len(target)-prefix &&
+		base[len(base)-1-suffix].Raw == target[len(target)-1-suffix].Raw {
+		suffix++
+	}
+	merged := make([]*Line, 0, len(base)+len(target))
+	merged = append(merged, base[:prefix]...)
+	merged = append(merged, mergeChanged(base[prefix:len(base)-suffix], target[prefix:len(target)-suffix])...)
+	return append(merged, base[len(base)-suffix:]...)
+}
+
+// Merges the lines of a gap that differ with the longest common subsequence
+// of the raw lines. Target lines that differ from the base at the same place
+// and are similar to one of the base lines there are older versions of it,
+// e.g. a comment of the base that was edited since the target was written.
+// They are replaced by the base lines, so that edits of the base do not
+// add more and more copies to the target.
+func mergeChanged(base, target []*Line) []*Line {
+	if len(base) == 0 || len(target) == 0 {
+		return append(slices.Clone(base), target...)
+	}
+	if len(base)*len(target) > maxMergeCells {
+		// Too large to compare every line, so the lines
+		// of the target that are not in the base come last
+		inBase := make(map[string]bool, len(base))
+		inTarget := make(map[string]bool, len(target))
+		for _, line := range base {
+			inBase[line.Raw] = true
+		}
+		for _, line := range target {
+			inTarget[line.Raw] = true
+		}
+		changedBase := slices.DeleteFunc(slices.Clone(base), func(line *Line) bool { return inTarget[line.Raw] })
+		changedTarget := slices.DeleteFunc(slices.Clone(target), func(line *Line) bool { return inBase[line.Raw] })
+		if len(changedBase)*len(changedTarget) <= maxMergeCells {
+			changedTarget = unedited(changedBase, changedTarget)
+		}
+		return append(slices.Clone(base), changedTarget...)
+	}
+
+	common := make([][]int, len(base)+1)
+	for i := range common {
+		common[i] = make([]int, len(target)+1)
+	}
+	for i := len(base) - 1; i >= 0; i-- {
+		for j := len(target) - 1; j >= 0; j-- {
+			if base[i].Raw == target[j].Raw {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	merged := make([]*Line, 0, len(base)+len(target))
+	// Lines between two common lines that are only in the base or the target
+	changedBase, changedTarget := make([]*Line, 0), make([]*Line, 0)
+	flush := func() {
+		merged = append(merged, unedited(changedBase, changedTarget)...)
+		changedBase, changedTarget = changedBase[:0], changedTarget[:0]
+	}
+	i, j := 0, 0
+	for i < len(base) && j < len(target) {
+		switch {
+		case base[i].Raw == target[j].Raw:
+			flush()
+			merged = append(merged, base[i])
+			i++
+			j++
+		case common[i+1][j] >= common[i][j+1]:
+			merged = append(merged, base[i])
+			changedBase = append(changedBase, base[i])
+			i++
+		default:
+			changedTarget = append(changedTarget, target[j])
+			j++
+		}
+	}
+	merged = append(merged, base[i:]...)
+	changedBase = append(changedBase, base[i:]...)
+	changedTarget = append(changedTarget, target[j:]...)
+	flush()
+	return merged
+}
+
+// Returns the target lines that are not an older version of one
+// of the base lines. Every base line replaces one target line at most.
+func unedited(base, target []*Line) []*Line {
+	kept := make([]*Line, 0, len(target))
+	replaced := make([]bool, len(base))
+	for _, line := range target {
+		edited := false
+		for k, baseLine := range base {
+			if !replaced[k] && isEdited(baseLine, line) {
+				replaced[k] = true
+				edited = true
+				break
+			}
+		}
+		if !edited {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+// Whether a target line is an older version of a base line
+func isEdited(base, target *Line) bool {
+	if base.Kind != target.Kind {
+		return false
+	}
+	return memory.Similarity(memory.Tokenize(base.Raw), memory.Tokenize(target.Raw)) >= editedSimilarity
+}
+
+// Decides which keys that only exist in the target file are kept.
+// Keys that moved to another file or were renamed are dropped once their
+// translation is in the target file of their new key, which might not be
+// written yet when the run stopped early. Until then they are kept.
+func (translator *ParadoxTranslator) keepOrphan(targetLanguage *LocalizationLanguage) func(key string) bool {
+	return func(key string) bool {
+		if newKey, ok := translator.movedKey(key); ok {
+			translator.filesLock.Lock()
+			defer translator.filesLock.Unlock()
+			return !translator.persisted[targetLanguage][newKey]
+		}
+		return translator.OrphanPolicy != OrphansPrune
+	}
+}
+
+// Returns the key of the base language that an orphaned
+// key moved to another file or was renamed to
+func (translator *ParadoxTranslator) movedKey(key string) (string, bool) {
+	if _, ok := translator.baseKeys[key]; ok {
+		return key, true
+	}
+	if newKey, ok := translator.Config.RenamedKeys[key]; ok {
+		if _, ok := translator.baseKeys[newKey]; ok {
+			return newKey, true
+		}
+	}
+	return "", false
+}
+
+// Records the keys of the base file that have a translation in the written target file
+func (translator *ParadoxTranslator) markPersisted(targetLanguage *LocalizationLanguage, baseFile, file *LocalizationFile) {
+	translator.filesLock.Lock()
+	defer translator.filesLock.Unlock()
+	for key := range baseFile.Localizations {
+		localization, ok := file.Localizations[key]
+		if ok && localization.CompareChecksum != skippedChecksum {
+			translator.persisted[targetLanguage][key] = true
+		}
+	}
+}
+
+// Logs the keys of the target file that are not in the base file
+func (translator *ParadoxTranslator) reportOrphans(baseFile, file *LocalizationFile, targetLanguage *LocalizationLanguage) {
+	keepOrphan := translator.keepOrphan(targetLanguage)
+	kept := 0
+	dropped := 0
+	for _, key := range slices.Sorted(maps.Keys(file.Localizations)) {
+		if _, ok := baseFile.Localizations[key]; ok {
+			continue
+		}
+		if !keepOrphan(key) {
+			dropped++
+			continue
+		}
+		if _, moved := translator.movedKey(key); moved {
+			// Kept until its new target file is written
+			continue
+		}
+		kept++
+		if translator.OrphanPolicy == OrphansReport {
+			logging.Warnf("Orphaned localization key (%s) in file (%s) is not in the base language", key, file.FileName)
+		}
+	}
+	if dropped > 0 {
+		logging.Infof(
+			"%s%s%s: Removed %s%d%s localization keys that are not in the base language anymore",
+			logging.AnsiBoldOn, file.FileName, logging.AnsiAllDefault,
+			logging.AnsiBoldOn, dropped, logging.AnsiAllDefault,
+		)
+	}
+	if kept > 0 {
+		logging.Debugf(
+			"%s%s%s: Kept %d localization keys that are not in the base language",
+			logging.AnsiBoldOn, file.FileName, logging.AnsiAllDefault, kept,
+		)
+	}
+}
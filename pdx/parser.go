@@ -0,0 +1,283 @@
+package pdx
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const byteOrderMark = "\uFEFF"
+const markerPrefix = "#deepl:"
+
+type LineKind int
+
+const (
+	LineBlank LineKind = iota
+	LineComment
+	LineHeader
+	LineEntry
+	// LineInvalid is a line that could not be parsed
+	LineInvalid
+)
+
+// Document is a parsed localization file with one entry per line
+type Document struct {
+	ByteOrderMark bool
+	Lines         []*Line
+}
+
+// Line of a localization file. Raw and Ending always
+// contain the original line, the other fields depend on the kind.
+type Line struct {
+	Kind   LineKind
+	Number int
+	Raw    string
+	Ending string
+
+	// Header
+	Language string
+
+	// Entry
+	Indent  string
+	Key     string
+	Version string
+	Text    string
+	Marker  string
+	Comment string
+}
+
+// ParseError describes a problem at a line and column (starting at 1) of a file
+type ParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (err *ParseError) Error() string {
+	if err.File == "" {
+		return fmt.Sprintf("%d:%d: %s", err.Line, err.Column, err.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", err.File, err.Line, err.Column, err.Message)
+}
+
+// ParseDocument parses the content of a localization file.
+// Lines that can not be parsed are kept as invalid lines
+// and reported as errors, the rest of the file is still parsed.
+func ParseDocument(content string) (*Document, []*ParseError) {
+	document := &Document{}
+	content, document.ByteOrderMark = strings.CutPrefix(content, byteOrderMark)
+
+	errors := make([]*ParseError, 0)
+	number := 0
+	for raw := range strings.Lines(content) {
+		number++
+		line := &Line{Number: number}
+		line.Raw, line.Ending = cutLineEnding(raw)
+		err := parseLine(line)
+		if err != nil {
+			line.Kind = LineInvalid
+			errors = append(errors, err)
+		}
+		document.Lines = append(document.Lines, line)
+	}
+	return document, errors
+}
+
+func cutLineEnding(raw string) (string, string) {
+	if line, ok := strings.CutSuffix(raw, "\r\n"); ok {
+		return line, "\r\n"
+	}
+	if line, ok := strings.CutSuffix(raw, "\n"); ok {
+		return line, "\n"
+	}
+	return raw, ""
+}
+
+// lexer reads the tokens of a single line
+type lexer struct {
+	line     *Line
+	position int
+}
+
+func (lexer *lexer) done() bool {
+	return lexer.position >= len(lexer.line.Raw)
+}
+
+func (lexer *lexer) peek() rune {
+	if lexer.done() {
+		return 0
+	}
+	current, _ := utf8.DecodeRuneInString(lexer.line.Raw[lexer.position:])
+	return current
+}
+
+func (lexer *lexer) next() rune {
+	current, size := utf8.DecodeRuneInString(lexer.line.Raw[lexer.position:])
+	lexer.position += size
+	return current
+}
+
+// Reads runes while the condition holds
+func (lexer *lexer) read(condition func(rune) bool) string {
+	start := lexer.position
+	for !lexer.done() && condition(lexer.peek()) {
+		lexer.next()
+	}
+	return lexer.line.Raw[start:lexer.position]
+}
+
+func (lexer *lexer) errorf(format string, arguments ...any) *ParseError {
+	return &ParseError{
+		Line:    lexer.line.Number,
+		Column:  utf8.RuneCountInString(lexer.line.Raw[:min(lexer.position, len(lexer.line.Raw))]) + 1,
+		Message: fmt.Sprintf(format, arguments...),
+	}
+}
+
+func isKeyRune(current rune) bool {
+	return !unicode.IsSpace(current) && current != ':' && current != '"' && current != '#'
+}
+
+func parseLine(line *Line) *ParseError {
+	lexer := &lexer{line: line}
+	line.Indent = lexer.read(unicode.IsSpace)
+	if lexer.done() {
+		line.Kind = LineBlank
+		return nil
+	}
+	if lexer.peek() == '#' {
+		line.Kind = LineComment
+		line.Comment = line.Raw[lexer.position:]
+		return nil
+	}
+
+	line.Key = lexer.read(isKeyRune)
+	if line.Key == "" {
+		return lexer.errorf("expected a localization key but found %q", lexer.peek())
+	}
+	if lexer.peek() != ':' {
+		return lexer.errorf("expected ':' after localization key %q", line.Key)
+	}
+	lexer.next()
+	line.Version = lexer.read(unicode.IsDigit)
+
+	rest := strings.TrimSpace(line.Raw[lexer.position:])
+	if rest == "" || strings.HasPrefix(rest, "#") {
+		if line.Version == "" && strings.HasPrefix(line.Key, "l_") {
+			// Header e.g. l_english:
+			line.Kind = LineHeader
+			line.Language = strings.TrimPrefix(line.Key, "l_")
+			line.Key = ""
+			lexer.read(unicode.IsSpace)
+			line.Comment = line.Raw[lexer.position:]
+			return nil
+		}
+		return lexer.errorf("expected quoted text for localization key %q", line.Key)
+	}
+	if !unicode.IsSpace(lexer.peek()) && lexer.peek() != '"' {
+		return lexer.errorf("expected a version number or quoted text for localization key %q but found %q", line.Key, lexer.peek())
+	}
+	lexer.read(unicode.IsSpace)
+	if lexer.peek() != '"' {
+		return lexer.errorf("expected quoted text for localization key %q but found %q", line.Key, lexer.peek())
+	}
+	lexer.next()
+
+	// The text ends at the first quote that is not escaped
+	// and is only followed by whitespace or a comment
+	textStart := lexer.position
+	textEnd := -1
+	for !lexer.done() {
+		current := lexer.next()
+		if current == '\\' && !lexer.done() {
+			lexer.next()
+			continue
+		}
+		if current == '"' && isTextEnd(line.Raw[lexer.position:]) {
+			textEnd = lexer.position - 1
+			if isAmbiguousEnd(line.Raw[textStart:textEnd], line.Raw[lexer.position:]) {
+				lexer.position = textEnd
+				return lexer.errorf("ambiguous end of the text for localization key %q, escape the quotes inside the text (\\\")", line.Key)
+			}
+			break
+		}
+	}
+	if textEnd < 0 {
+		lexer.position = textStart - 1
+		return lexer.errorf("missing closing quote of the text for localization key %q", line.Key)
+	}
+	line.Text = line.Raw[textStart:textEnd]
+	line.Kind = LineEntry
+
+	lexer.read(unicode.IsSpace)
+	comment := line.Raw[lexer.position:]
+	if strings.HasPrefix(comment, markerPrefix) {
+		line.Marker = lexer.read(func(current rune) bool { return !unicode.IsSpace(current) })
+		lexer.read(unicode.IsSpace)
+		comment = line.Raw[lexer.position:]
+	}
+	line.Comment = comment
+	return nil
+}
+
+// Checks whether the rest of a line after a quote is a comment.
+// A # after whitespace starts a comment (see isAmbiguousEnd). A # directly after the quote
+// and followed by a letter or ! is formatting inside the text, unless
+// there is no other quote that ends the text.
+func isTextEnd(rest string) bool {
+	trimmed := strings.TrimLeftFunc(rest, unicode.IsSpace)
+	if trimmed == "" || strings.HasPrefix(trimmed, markerPrefix) {
+		return true
+	}
+	comment, ok := strings.CutPrefix(trimmed, "#")
+	if !ok {
+		return false
+	}
+	if len(trimmed) < len(rest) {
+		return true
+	}
+	next, _ := utf8.DecodeRuneInString(comment)
+	if unicode.IsLetter(next) || next == '!' {
+		return !strings.Contains(comment, "\"")
+	}
+	return true
+}
+
+// Checks whether a quote that is followed by a comment might also close a quote
+// inside the text, e.g. "He said "hi" #bold x#!". That is the case when the text
+// before it has an open quote and a later quote could end the text as well.
+func isAmbiguousEnd(text, rest string) bool {
+	trimmed := strings.TrimLeftFunc(rest, unicode.IsSpace)
+	if !strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, markerPrefix) {
+		return false
+	}
+	if unescapedQuotes(text)%2 == 0 {
+		return false
+	}
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case '\\':
+			i++
+		case '"':
+			if isTextEnd(rest[i+1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unescapedQuotes(text string) int {
+	count := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,125 @@
+package pdx
+
+import (
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		kind    LineKind
+		key     string
+		version string
+		text    string
+		marker  string
+		comment string
+	}{
+		{name: "blank", raw: "   ", kind: LineBlank},
+		{name: "comment", raw: ` # comment with "quotes"`, kind: LineComment, comment: `# comment with "quotes"`},
+		{name: "header", raw: "l_english:", kind: LineHeader},
+		{name: "header with comment", raw: "l_english: # comment", kind: LineHeader, comment: "# comment"},
+		{name: "entry", raw: ` key: "Hello"`, kind: LineEntry, key: "key", text: "Hello"},
+		{name: "version", raw: ` key:0 "Hello"`, kind: LineEntry, key: "key", version: "0", text: "Hello"},
+		{name: "escaped quotes", raw: ` key:1 "Say \"hi\" now"`, kind: LineEntry, key: "key", version: "1", text: `Say \"hi\" now`},
+		{name: "empty text", raw: ` key: ""`, kind: LineEntry, key: "key"},
+		{
+			name: "comment with quotes", raw: ` key:0 "Hello" # a "quoted" comment`,
+			kind: LineEntry, key: "key", version: "0", text: "Hello", comment: `# a "quoted" comment`,
+		},
+		{
+			name: "comment with letter and quotes", raw: ` key:0 "Hello" #TODO check "wording"`,
+			kind: LineEntry, key: "key", version: "0", text: "Hello", comment: `#TODO check "wording"`,
+		},
+		{
+			name: "marker", raw: ` key: "Hallo" #deepl:12345`,
+			kind: LineEntry, key: "key", text: "Hallo", marker: "#deepl:12345",
+		},
+		{
+			name: "marker with backend and comment", raw: ` key: "Hallo" #deepl:12345:openai # note "x"`,
+			kind: LineEntry, key: "key", text: "Hallo", marker: "#deepl:12345:openai", comment: `# note "x"`,
+		},
+		{
+			name: "formatting", raw: ` key: "Some #bold text#! here"`,
+			kind: LineEntry, key: "key", text: "Some #bold text#! here",
+		},
+		{
+			name: "formatting after quote", raw: ` key: "Say "#bold hi#!" now"`,
+			kind: LineEntry, key: "key", text: `Say "#bold hi#!" now`,
+		},
+		{
+			name: "inner quotes and comment", raw: ` key: "Say "hi" now" # note`,
+			kind: LineEntry, key: "key", text: `Say "hi" now`, comment: "# note",
+		},
+		{
+			name: "comment directly after quote", raw: ` key: "Hello"#comment`,
+			kind: LineEntry, key: "key", text: "Hello", comment: "#comment",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document, errors := ParseDocument(test.raw)
+			if len(errors) > 0 {
+				t.Fatalf("unexpected error: %s", errors[0])
+			}
+			line := document.Lines[0]
+			if line.Kind != test.kind {
+				t.Fatalf("kind = %d, want %d", line.Kind, test.kind)
+			}
+			if line.Key != test.key || line.Version != test.version || line.Text != test.text {
+				t.Errorf("key, version, text = %q, %q, %q, want %q, %q, %q", line.Key, line.Version, line.Text, test.key, test.version, test.text)
+			}
+			if line.Marker != test.marker || line.Comment != test.comment {
+				t.Errorf("marker, comment = %q, %q, want %q, %q", line.Marker, line.Comment, test.marker, test.comment)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		column int
+	}{
+		{name: "missing colon", raw: " broken line", column: 8},
+		{name: "missing text", raw: " key:0", column: 7},
+		{name: "missing closing quote", raw: ` key: "Hello`, column: 7},
+		{name: "text without quotes", raw: " key: Hello", column: 7},
+		{name: "invalid version", raw: ` key:a "Hello"`, column: 6},
+		{name: "ambiguous quote", raw: ` key: "He said "hi" #bold x#!"`, column: 19},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document, errors := ParseDocument("l_english:\n" + test.raw + "\n")
+			if len(errors) != 1 {
+				t.Fatalf("got %d errors, want 1", len(errors))
+			}
+			if errors[0].Line != 2 || errors[0].Column != test.column {
+				t.Errorf("position = %d:%d, want 2:%d (%s)", errors[0].Line, errors[0].Column, test.column, errors[0].Message)
+			}
+			if document.Lines[1].Kind != LineInvalid {
+				t.Errorf("kind = %d, want invalid", document.Lines[1].Kind)
+			}
+		})
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	document, errors := ParseDocument(byteOrderMark + "l_english:\r\n key: \"Hello\"\r\n\r\n other: \"World\"")
+	if len(errors) > 0 {
+		t.Fatalf("unexpected error: %s", errors[0])
+	}
+	if !document.ByteOrderMark {
+		t.Error("byte order mark was not detected")
+	}
+	if len(document.Lines) != 4 {
+		t.Fatalf("got %d lines, want 4", len(document.Lines))
+	}
+	if document.Lines[0].Language != "english" || document.Lines[0].Ending != "\r\n" {
+		t.Errorf("header = %q with ending %q", document.Lines[0].Language, document.Lines[0].Ending)
+	}
+	if document.Lines[2].Kind != LineBlank || document.Lines[3].Ending != "" || document.Lines[3].Number != 4 {
+		t.Errorf("unexpected lines %+v %+v", document.Lines[2], document.Lines[3])
+	}
+}
@@ -0,0 +1,145 @@
+package pdx
+
+import (
+	"bahmut.de/pdx-deepl/logging"
+	"slices"
+)
+
+// Plan lists the localization keys and characters
+// that have to be translated in a run
+type Plan struct {
+	Languages  []*PlannedLanguage
+	Keys       int
+	Characters int
+}
+
+type PlannedLanguage struct {
+	Language   string
+	Files      int
+	Keys       int
+	Characters int
+	Remembered int
+}
+
+// Plan counts the missing and outdated localization keys of all target languages
+// and the characters that are sent to the translation API for them.
+// Keys in the translation memory and repeated texts do not need characters.
+func (translator *ParadoxTranslator) Plan() (*Plan, error) {
+	err := translator.load()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	languages := make(map[*LocalizationLanguage]*PlannedLanguage)
+	requests := make(map[*LocalizationLanguage]map[string]bool)
+	for _, job := range translator.createJobs() {
+		plannedLanguage, ok := languages[job.TargetLanguage]
+		if !ok {
+			plannedLanguage = &PlannedLanguage{Language: job.TargetLanguage.Name}
+			languages[job.TargetLanguage] = plannedLanguage
+			requests[job.TargetLanguage] = make(map[string]bool)
+			plan.Languages = append(plan.Languages, plannedLanguage)
+		}
+
+		pending, remembered := translator.jobPending(job)
+		if len(pending) == 0 && remembered == 0 {
+			continue
+		}
+		plannedLanguage.Files++
+		plannedLanguage.Keys += len(pending)
+		plannedLanguage.Remembered += remembered
+		for _, entry := range pending {
+			if requests[job.TargetLanguage][entry.Request] {
+				continue
+			}
+			requests[job.TargetLanguage][entry.Request] = true
+			plannedLanguage.Characters += countCharacters(entry.Request)
+		}
+	}
+
+	for _, plannedLanguage := range plan.Languages {
+		plan.Keys += plannedLanguage.Keys
+		plan.Characters += plannedLanguage.Characters
+		logging.Infof(
+			"%sPlanned:%s %s with %d localization keys (%d characters) in %d files",
+			logging.AnsiBoldOn, logging.AnsiAllDefault,
+			plannedLanguage.Language, plannedLanguage.Keys, plannedLanguage.Characters, plannedLanguage.Files,
+		)
+		if plannedLanguage.Remembered > 0 {
+			logging.Infof(
+				"%sPlanned:%s %s with %d localization keys from the translation memory",
+				logging.AnsiBoldOn, logging.AnsiAllDefault,
+				plannedLanguage.Language, plannedLanguage.Remembered,
+			)
+		}
+	}
+	return plan, nil
+}
+
+// Limits the jobs to the character budget of the run.
+// The budget goes to missing keys before outdated ones and to the jobs in their order,
+// so every job gets the characters for the first of its pending keys.
+func (translator *ParadoxTranslator) applyBudget(jobs []*translationJob) {
+	if translator.CharacterBudget <= 0 {
+		return
+	}
+
+	pendingJobs := make([][]*pendingLocalization, len(jobs))
+	for i, job := range jobs {
+		job.MaxCharacters = 0
+		pendingJobs[i], _ = translator.jobPending(job)
+	}
+
+	budget := translator.CharacterBudget
+	keys := 0
+	for _, missing := range []bool{true, false} {
+		for i, job := range jobs {
+			for _, entry := range pendingJobs[i] {
+				if entry.Missing != missing {
+					continue
+				}
+				characters := countCharacters(entry.Request)
+				if characters > budget {
+					logging.Infof(
+						"%sCharacter Budget:%s %d characters for %d localization keys",
+						logging.AnsiBoldOn, logging.AnsiAllDefault, translator.CharacterBudget-budget, keys,
+					)
+					return
+				}
+				budget -= characters
+				job.MaxCharacters += characters
+				keys++
+			}
+		}
+	}
+	for _, job := range jobs {
+		job.MaxCharacters = -1
+	}
+}
+
+// Finds the localizations of a job that have to be translated
+// and counts the ones that are in the translation memory
+func (translator *ParadoxTranslator) jobPending(job *translationJob) ([]*pendingLocalization, int) {
+	if slices.Contains(translator.Config.IgnoreFiles, job.BaseFile.FileName) {
+		return nil, 0
+	}
+	targetFile := job.TargetLanguage.Files[job.BaseFile.Key]
+	file := translator.targetFileFor(job.BaseFile, targetFile, job.TargetLanguage)
+	file = withCarryOver(file, translator.findCarryOver(job.BaseFile, file, job.TargetLanguage))
+	pending, _, _ := translator.findPending(job.BaseFile, file)
+	pending, remembered := translator.splitRemembered(pending, job.TargetLanguage, translator.requestGlossary(job.LanguageConfig))
+	pending, _ = translator.splitFuzzy(pending, job.TargetLanguage)
+	return pending, len(remembered)
+}
+
+// Returns the first pending localizations that fit into the characters
+func fitCharacters(pending []*pendingLocalization, characters int) []*pendingLocalization {
+	for i, entry := range pending {
+		characters -= countCharacters(entry.Request)
+		if characters < 0 {
+			return pending[:i]
+		}
+	}
+	return pending
+}
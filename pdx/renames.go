@@ -0,0 +1,107 @@
+package pdx
+
+import (
+	"bahmut.de/pdx-deepl/logging"
+	"maps"
+	"slices"
+)
+
+// Localizations of a target language whose keys are not
+// in the base file anymore, because they were renamed or moved
+type orphans struct {
+	ByKey      map[string]*Localization
+	ByChecksum map[uint32]*Localization
+	// All localizations of the target language for renamed keys of the config
+	All map[string]*Localization
+}
+
+// Collects the orphans of every target language before any file is written
+func (translator *ParadoxTranslator) collectOrphans() {
+	translator.orphans = make(map[*LocalizationLanguage]*orphans)
+	for _, targetLanguage := range translator.TargetLanguages {
+		languageOrphans := &orphans{
+			ByKey:      make(map[string]*Localization),
+			ByChecksum: make(map[uint32]*Localization),
+			All:        make(map[string]*Localization),
+		}
+		for _, fileKey := range slices.Sorted(maps.Keys(targetLanguage.Files)) {
+			targetFile := targetLanguage.Files[fileKey]
+			baseFile := translator.BaseLanguage.Files[fileKey]
+			for _, key := range slices.Sorted(maps.Keys(targetFile.Localizations)) {
+				localization := targetFile.Localizations[key]
+				if _, ok := languageOrphans.All[key]; !ok {
+					languageOrphans.All[key] = localization
+				}
+				if baseFile != nil {
+					if _, ok := baseFile.Localizations[key]; ok {
+						continue
+					}
+				}
+				if _, ok := languageOrphans.ByKey[key]; !ok {
+					languageOrphans.ByKey[key] = localization
+				}
+				if localization.CompareChecksum == 0 || localization.CompareChecksum == skippedChecksum || localization.Backend == reviewBackend {
+					continue
+				}
+				if _, ok := languageOrphans.ByChecksum[localization.CompareChecksum]; !ok {
+					languageOrphans.ByChecksum[localization.CompareChecksum] = localization
+				}
+			}
+		}
+		translator.orphans[targetLanguage] = languageOrphans
+	}
+}
+
+// Finds the translations of renamed or moved keys for the keys
+// of the base file that are missing in the target file.
+// Renamed keys of the config come first, then keys that moved
+// from another file and then keys with the same base text.
+func (translator *ParadoxTranslator) findCarryOver(
+	baseFile,
+	file *LocalizationFile,
+	targetLanguage *LocalizationLanguage,
+) map[string]*Localization {
+	carryOver := make(map[string]*Localization)
+	languageOrphans := translator.orphans[targetLanguage]
+	if languageOrphans == nil {
+		return carryOver
+	}
+	for key, localization := range baseFile.Localizations {
+		if existing, ok := file.Localizations[key]; ok && existing.CompareChecksum != skippedChecksum {
+			continue
+		}
+		var previous *Localization
+		if oldKey, ok := translator.renamedKeys[key]; ok {
+			previous = languageOrphans.All[oldKey]
+		}
+		if previous == nil {
+			previous = languageOrphans.ByKey[key]
+		}
+		if previous == nil {
+			previous = languageOrphans.ByChecksum[localization.Checksum]
+		}
+		if previous == nil || previous.CompareChecksum == skippedChecksum {
+			continue
+		}
+		carryOver[key] = &Localization{
+			Key:             key,
+			Version:         localization.Version,
+			Text:            previous.Text,
+			CompareChecksum: previous.CompareChecksum,
+			Backend:         previous.Backend,
+		}
+		logging.Debugf("Carried over localization key (%s) as (%s) in file (%s)", previous.Key, key, file.FileName)
+	}
+	return carryOver
+}
+
+// Returns a copy of the target file with the carried over localizations
+func withCarryOver(file *LocalizationFile, carryOver map[string]*Localization) *LocalizationFile {
+	if len(carryOver) == 0 {
+		return file
+	}
+	copied := *file
+	copied.Localizations = maps.Clone(file.Localizations)
+	maps.Copy(copied.Localizations, carryOver)
+	return &copied
+}
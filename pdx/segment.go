@@ -0,0 +1,164 @@
+package pdx
+
+import (
+	"strings"
+	"unicode"
+)
+
+const sentenceTerminators = ".!?…。！？"
+const sentenceClosings = "\"')»”’"
+
+// segment is a part of a text. Sentences are translated,
+// separators between them are kept as they are.
+type segment struct {
+	Text      string
+	Translate bool
+}
+
+// Splits a text into sentences and the separators between them.
+// A sentence ends at a terminator followed by whitespace and no lower case
+// letter, or at a line break (\n). Texts are never split inside functions,
+// references, icons or formatting.
+func segmentText(text string) []segment {
+	runes := []rune(text)
+	pieces := make([]string, 0)
+	start := 0
+	functionDepth := 0
+	formattingDepth := 0
+	inReference := false
+	inIcon := false
+	for i := 0; i < len(runes); i++ {
+		current := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case current == '[':
+			functionDepth++
+			continue
+		case current == ']' && functionDepth > 0:
+			functionDepth--
+			continue
+		case functionDepth > 0:
+			continue
+		case current == '$':
+			inReference = !inReference
+			continue
+		case inReference:
+			continue
+		case current == '£':
+			inIcon = !inIcon
+			continue
+		case inIcon:
+			continue
+		case current == '#' && next == '!':
+			formattingDepth = max(formattingDepth-1, 0)
+			i++
+			continue
+		case current == '#' && unicode.IsLetter(next):
+			formattingDepth++
+			continue
+		case formattingDepth > 0:
+			continue
+		}
+
+		if current == '\\' && next == 'n' {
+			// Line breaks are separators of their own
+			pieces = append(pieces, string(runes[start:i]), `\n`)
+			start = i + 2
+			i++
+			continue
+		}
+		if !strings.ContainsRune(sentenceTerminators, current) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && strings.ContainsRune(sentenceTerminators+sentenceClosings, runes[end]) {
+			end++
+		}
+		following := end
+		for following < len(runes) && unicode.IsSpace(runes[following]) {
+			following++
+		}
+		if following == end && end < len(runes) {
+			// No whitespace after the terminator e.g. 1.5
+			continue
+		}
+		if following < len(runes) && unicode.IsLower(runes[following]) {
+			// Probably an abbreviation e.g. "e.g. this"
+			continue
+		}
+		pieces = append(pieces, string(runes[start:end]))
+		start = end
+		i = end - 1
+	}
+	pieces = append(pieces, string(runes[start:]))
+
+	segments := make([]segment, 0, len(pieces))
+	addSeparator := func(separator string) {
+		if separator == "" {
+			return
+		}
+		if len(segments) > 0 && !segments[len(segments)-1].Translate {
+			segments[len(segments)-1].Text += separator
+			return
+		}
+		segments = append(segments, segment{Text: separator})
+	}
+	for _, piece := range pieces {
+		if piece == `\n` {
+			addSeparator(piece)
+			continue
+		}
+		sentence := strings.TrimSpace(piece)
+		if sentence == "" {
+			addSeparator(piece)
+			continue
+		}
+		leading := piece[:strings.Index(piece, sentence)]
+		addSeparator(leading)
+		segments = append(segments, segment{Text: sentence, Translate: true})
+		addSeparator(piece[len(leading)+len(sentence):])
+	}
+	return segments
+}
+
+// Splits a base text into sentences when sentence
+// segmentation is enabled, otherwise into one segment
+func (translator *ParadoxTranslator) segments(text string) []segment {
+	if !translator.SegmentSentences {
+		return []segment{{Text: text, Translate: true}}
+	}
+	return segmentText(text)
+}
+
+// Joins the translations of the sentences and the separators.
+// The result is remembered when every sentence was in the translation memory.
+func assembleSegments(segments []segment, results map[string]*translation, backendName string) *translation {
+	var builder strings.Builder
+	assembled := &translation{}
+	sentences := 0
+	remembered := 0
+	for _, part := range segments {
+		if !part.Translate {
+			builder.WriteString(part.Text)
+			continue
+		}
+		result := results[part.Text]
+		builder.WriteString(result.Text)
+		if assembled.Backend == "" {
+			assembled.Backend = result.Backend
+		}
+		sentences++
+		if result.Remembered {
+			remembered++
+		}
+	}
+	if assembled.Backend == "" {
+		assembled.Backend = backendName
+	}
+	assembled.Text = builder.String()
+	assembled.Remembered = sentences > 0 && remembered == sentences
+	return assembled
+}
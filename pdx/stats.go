@@ -18,9 +18,11 @@ func (translator *ParadoxTranslator) Statistics() error {
 	logging.Infof("%sLocalization Files:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, len(baseLanguage.Files))
 	keyCount := 0
 	characterCount := 0
+	invalidCount := 0
 
 	for _, file := range baseLanguage.Files {
 		keyCount = keyCount + len(file.Localizations)
+		invalidCount = invalidCount + len(file.Errors)
 		for _, localization := range file.Localizations {
 			clean := ignoreTagRegex.ReplaceAllString(localization.Text, "")
 			clean = referenceTagRegex.ReplaceAllString(localization.Text, "")
@@ -30,5 +32,11 @@ func (translator *ParadoxTranslator) Statistics() error {
 
 	logging.Infof("%sLocalization Keys:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, keyCount)
 	logging.Infof("%sTotal Characters:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, characterCount)
+	logging.Infof("%sInvalid Lines:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, invalidCount)
 	return nil
 }
+
+// Counts the characters of a localization text like the translation APIs do
+func countCharacters(text string) int {
+	return utf8.RuneCountInString(text)
+}
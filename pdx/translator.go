@@ -1,14 +1,19 @@
 package pdx
 
 import (
-	"bahmut.de/pdx-deepl/deepl"
+	"bahmut.de/pdx-deepl/backend"
 	"bahmut.de/pdx-deepl/logging"
+	"bahmut.de/pdx-deepl/memory"
+	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,16 +27,65 @@ var regexFormatting = regexp.MustCompile(`#[a-zA-Z]+\s`)
 type ParadoxTranslator struct {
 	Config                *TranslationConfiguration
 	LocalizationDirectory string
-	Api                   *deepl.Api
+	Backend               backend.Backend
 	BaseLanguage          *LocalizationLanguage
 	TargetLanguages       []*LocalizationLanguage
+	// Workers is the number of files translated at the same time
+	Workers int
+	// CheckpointKeys and CheckpointInterval control how often a file
+	// is written while it is translated (0 disables the checkpoint)
+	CheckpointKeys     int
+	CheckpointInterval time.Duration
+	// CharacterBudget is the maximum number of characters
+	// translated in this run (0 for no limit)
+	CharacterBudget int
+	// Memory serves translations of texts that were translated
+	// before and stores new ones (nil to disable)
+	Memory *memory.Memory
+	// FuzzyThreshold enables the search for translations of similar texts
+	// with at least this similarity between 0 and 1 (0 to disable)
+	FuzzyThreshold float64
+	// FuzzyDrafts writes the translations of similar texts
+	// marked for review instead of translating the keys
+	FuzzyDrafts bool
+	// VersionChanges retranslates localizations whose version number
+	// in the base language changed, even when the text is the same
+	VersionChanges bool
+	// OrphanPolicy decides what happens to localization keys that
+	// only exist in a target file (keep, report or prune)
+	OrphanPolicy string
+	// SegmentSentences translates every sentence of a text on its own,
+	// so that only changed sentences of a text are translated again
+	SegmentSentences bool
+	// FuzzyMatches lists the translations of similar texts
+	// that were found for the translated keys
+	FuzzyMatches []*FuzzyMatch
+	// Pending lists the files with keys that were left
+	// for the next run because the translation stopped
+	Pending []*PendingFile
+
+	filesLock   sync.Mutex
+	pendingLock sync.Mutex
+
+	fuzzyIndexes map[*LocalizationLanguage]*memory.Index
+	orphans      map[*LocalizationLanguage]*orphans
+	renamedKeys  map[string]string
+	// baseKeys maps the localization keys of the base language to their file
+	baseKeys map[string]string
+	// persisted holds the keys of every target language that have a
+	// translation in the target file of their base file, guarded by filesLock
+	persisted map[*LocalizationLanguage]map[string]bool
 }
 
-func CreateTranslator(configFile, localizationDirectory string, api *deepl.Api) (*ParadoxTranslator, error) {
-	config, err := readConfigFile(configFile)
-	if err != nil {
-		return nil, err
-	}
+type PendingFile struct {
+	Language string
+	FileName string
+	Keys     int
+}
+
+// CreateTranslator creates a translator for the localization directory.
+// The backend can be nil for commands that do not translate.
+func CreateTranslator(config *TranslationConfiguration, localizationDirectory string, translationBackend backend.Backend) (*ParadoxTranslator, error) {
 	targetLanguages := make([]string, len(config.TargetLanguages))
 	for i, language := range config.TargetLanguages {
 		targetLanguages[i] = language.Name
@@ -43,36 +97,126 @@ func CreateTranslator(configFile, localizationDirectory string, api *deepl.Api)
 		strings.Join(targetLanguages, ", "),
 	)
 
+	if translationBackend != nil {
+		capabilities := translationBackend.Capabilities()
+		for _, language := range config.TargetLanguages {
+			if language.Glossary != "" && !capabilities.Glossary {
+				logging.Warnf("Backend %s does not support glossaries, ignoring glossary of %s", translationBackend.Name(), language.Name)
+			}
+		}
+		if !capabilities.TagHandling {
+			logging.Warnf("Backend %s does not support tag handling, functions and references may get translated", translationBackend.Name())
+		}
+	}
+
 	return &ParadoxTranslator{
 		Config:                config,
 		LocalizationDirectory: localizationDirectory,
-		Api:                   api,
+		Backend:               translationBackend,
+		Workers:               1,
+		CheckpointKeys:        DefaultCheckpointKeys,
+		CheckpointInterval:    DefaultCheckpointInterval,
+		OrphanPolicy:          OrphansKeep,
 	}, nil
 }
 
-func (translator *ParadoxTranslator) Translate() error {
+func (translator *ParadoxTranslator) Translate(ctx context.Context) error {
+	err := translator.load()
+	if err != nil {
+		return err
+	}
+	jobs := translator.createJobs()
+	translator.applyBudget(jobs)
+	return translator.runJobs(ctx, jobs)
+}
+
+// Reads the base and target languages once
+func (translator *ParadoxTranslator) load() error {
+	if translator.BaseLanguage != nil {
+		return nil
+	}
 	baseLanguage, err := readLanguage(translator.LocalizationDirectory, translator.Config.BaseLanguage)
 	if err != nil {
 		return err
 	}
 	logging.Infof("%sBase Language:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, baseLanguage.Name)
+	warnParseErrors(baseLanguage)
+	translator.warnEncoding(baseLanguage, true)
 
-	translator.BaseLanguage = baseLanguage
-
+	targetLanguages := make([]*LocalizationLanguage, 0, len(translator.Config.TargetLanguages))
 	for _, targetLanguageConfig := range translator.Config.TargetLanguages {
 		targetLanguage, err := translator.readTargetLanguage(targetLanguageConfig.Name)
 		if err != nil {
 			return err
 		}
-		logging.Infof("%sTranslating:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, targetLanguage.Name)
-		translatedLanguage, err := translator.translateTargetLanguage(targetLanguage, targetLanguageConfig.Glossary)
-		translator.TargetLanguages = append(translator.TargetLanguages, translatedLanguage)
-		logging.Infof("%sTranslated:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, targetLanguage.Name)
+		warnParseErrors(targetLanguage)
+		translator.warnEncoding(targetLanguage, false)
+		targetLanguages = append(targetLanguages, targetLanguage)
 	}
 
+	translator.BaseLanguage = baseLanguage
+	translator.TargetLanguages = targetLanguages
+	translator.renamedKeys = make(map[string]string)
+	for oldKey, newKey := range translator.Config.RenamedKeys {
+		translator.renamedKeys[newKey] = oldKey
+	}
+	translator.baseKeys = make(map[string]string)
+	for fileKey, file := range baseLanguage.Files {
+		for key := range file.Localizations {
+			translator.baseKeys[key] = fileKey
+		}
+	}
+	translator.persisted = make(map[*LocalizationLanguage]map[string]bool)
+	for _, targetLanguage := range targetLanguages {
+		translator.persisted[targetLanguage] = make(map[string]bool)
+		for fileKey, file := range targetLanguage.Files {
+			if baseFile, ok := baseLanguage.Files[fileKey]; ok {
+				translator.markPersisted(targetLanguage, baseFile, file)
+			}
+		}
+	}
+	translator.collectOrphans()
+	if translator.FuzzyThreshold > 0 {
+		translator.createFuzzyIndexes()
+	}
 	return nil
 }
 
+// Creates one job for every base file and target language.
+// Jobs of priority files come first, in the order of the config.
+func (translator *ParadoxTranslator) createJobs() []*translationJob {
+	priorityFiles := make([]*LocalizationFile, 0)
+	otherFiles := make([]*LocalizationFile, 0)
+	for _, file := range translator.BaseLanguage.Files {
+		if slices.Contains(translator.Config.PriorityFiles, file.FileName) {
+			priorityFiles = append(priorityFiles, file)
+		} else {
+			otherFiles = append(otherFiles, file)
+		}
+	}
+	slices.SortFunc(priorityFiles, func(a, b *LocalizationFile) int {
+		return slices.Index(translator.Config.PriorityFiles, a.FileName) - slices.Index(translator.Config.PriorityFiles, b.FileName)
+	})
+	slices.SortFunc(otherFiles, func(a, b *LocalizationFile) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	jobs := make([]*translationJob, 0)
+	for _, files := range [][]*LocalizationFile{priorityFiles, otherFiles} {
+		for i, targetLanguageConfig := range translator.Config.TargetLanguages {
+			for _, file := range files {
+				jobs = append(jobs, &translationJob{
+					BaseFile:       file,
+					TargetLanguage: translator.TargetLanguages[i],
+					LanguageConfig: targetLanguageConfig,
+					MaxCharacters:  -1,
+				})
+			}
+		}
+	}
+	return jobs
+}
+
 func (translator *ParadoxTranslator) readTargetLanguage(language string) (*LocalizationLanguage, error) {
 	languagePath := filepath.Join(translator.LocalizationDirectory, language)
 	if _, err := os.Stat(languagePath); os.IsNotExist(err) {
@@ -89,112 +233,182 @@ func (translator *ParadoxTranslator) readTargetLanguage(language string) (*Local
 	return targetLanguage, nil
 }
 
-func (translator *ParadoxTranslator) translateTargetLanguage(targetLanguage *LocalizationLanguage, glossary string) (*LocalizationLanguage, error) {
-	for key, file := range translator.BaseLanguage.Files {
-		translatedFile, err := translator.translateTargetFile(file, targetLanguage.Files[key], targetLanguage, glossary)
-		if err != nil {
-			return nil, err
-		}
-		if translatedFile == nil {
-			continue
-		}
-		targetLanguage.Files[key] = translatedFile
-	}
-
-	return targetLanguage, nil
-}
-
 func (translator *ParadoxTranslator) translateTargetFile(
+	ctx context.Context,
 	baseFile,
 	targetFile *LocalizationFile,
 	targetLanguage *LocalizationLanguage,
-	glossary string,
+	languageConfig *TranslationConfigurationLanguage,
+	maxCharacters int,
 ) (*LocalizationFile, error) {
 	if slices.Contains(translator.Config.IgnoreFiles, baseFile.FileName) {
 		logging.Warnf("Skipped ignored file: %s", baseFile.FileName)
 		return nil, nil
 	}
 
-	var file *LocalizationFile
-	if targetFile == nil {
-		baseTag := fmt.Sprintf("l_%s.yml", translator.BaseLanguage.Name)
-		targetTag := fmt.Sprintf("l_%s.yml", targetLanguage.Name)
-		name := strings.ReplaceAll(
-			baseFile.FileName,
-			baseTag,
-			targetTag,
-		)
-		path := filepath.Join(translator.LocalizationDirectory, targetLanguage.Name, name)
-		file = &LocalizationFile{
-			Key:           baseFile.Key,
-			Path:          path,
-			FileName:      name,
-			Localizations: make(map[string]*Localization),
-		}
-	} else {
-		file = targetFile
-	}
+	file := translator.targetFileFor(baseFile, targetFile, targetLanguage)
+	// Paradox games ignore files without a byte order mark
+	file.ByteOrderMark = baseFile.ByteOrderMark || !translator.Config.NoByteOrderMark
 	logging.Infof(
 		"%s%s%s: Starting",
 		logging.AnsiBoldOn, file.FileName, logging.AnsiAllDefault,
 	)
 
-	counterManual := 0
-	counterUpToDate := 0
+	carryOver := translator.findCarryOver(baseFile, file, targetLanguage)
+	maps.Copy(file.Localizations, carryOver)
+
+	pending, counterManual, counterUpToDate := translator.findPending(baseFile, file)
+	// Carried over keys are only counted as carried over, or as
+	// translated when they are outdated and translated again
+	pendingKeys := make(map[string]bool, len(pending))
+	for _, entry := range pending {
+		pendingKeys[entry.Base.Key] = true
+	}
+	counterCarriedOver := 0
+	for key, localization := range carryOver {
+		if pendingKeys[key] {
+			continue
+		}
+		counterCarriedOver++
+		if localization.CompareChecksum == 0 {
+			counterManual--
+		} else {
+			counterUpToDate--
+		}
+	}
 	counterTranslated := 0
 	counterError := 0
-	for key, localization := range baseFile.Localizations {
-		targetLocalization, ok := file.Localizations[key]
-		if !ok {
-			targetLocalization = &Localization{
-				Key:             key,
-				CompareChecksum: 1, // Mark as to be translated
-			}
+	counterPending := 0
+	counterMemory := 0
+	counterDrafts := 0
+
+	// Missing keys are written as skipped until they are translated,
+	// so that every checkpoint of the file can be picked up by the next run
+	for _, entry := range pending {
+		if _, ok := file.Localizations[entry.Base.Key]; !ok {
+			entry.Target.Text = entry.Base.Text
+			entry.Target.CompareChecksum = skippedChecksum
+			entry.Target.Version = entry.Base.Version
+			file.Localizations[entry.Base.Key] = entry.Target
 		}
-		if targetLocalization.CompareChecksum == 0 {
-			// Don't touch manual localizations
-			// in the target language
-			counterManual++
-			continue
+	}
+
+	glossary := translator.requestGlossary(languageConfig)
+	pending, remembered := translator.splitRemembered(pending, targetLanguage, glossary)
+	for entry, found := range remembered {
+		entry.Target.Text = found.Translation
+		entry.Target.CompareChecksum = entry.Base.Checksum
+		entry.Target.Version = entry.Base.Version
+		entry.Target.Backend = found.Backend
+		file.Localizations[entry.Base.Key] = entry.Target
+		counterMemory++
+	}
+
+	pending, fuzzyMatches := translator.splitFuzzy(pending, targetLanguage)
+	for entry, match := range fuzzyMatches {
+		translator.addFuzzyMatch(targetLanguage, file.FileName, entry, match)
+		if translator.FuzzyDrafts {
+			entry.Target.Text = match.Translation
+			entry.Target.CompareChecksum = entry.Base.Checksum
+			entry.Target.Version = entry.Base.Version
+			entry.Target.Backend = reviewBackend
+			file.Localizations[entry.Base.Key] = entry.Target
+			counterDrafts++
 		}
-		if localization.Checksum == targetLocalization.CompareChecksum {
-			// Localization was already translated
-			// and is up to date
-			counterUpToDate++
-			continue
+	}
+
+	if maxCharacters >= 0 {
+		// The rest does not fit into the character budget
+		// and is left for the next run
+		fitting := fitCharacters(pending, maxCharacters)
+		counterPending += len(pending) - len(fitting)
+		pending = fitting
+	}
+
+	var runError error
+	checkpoint := translator.createCheckpoint()
+	capabilities := translator.Backend.Capabilities()
+	batches := createBatches(pending, capabilities.MaxTexts, capabilities.MaxRequestSize)
+	for batchIndex, batch := range batches {
+		var translations []*translation
+		err := ctx.Err()
+		if err == nil {
+			translations, err = translator.translateBatch(ctx, batch, targetLanguage, languageConfig)
 		}
-		response, err := translator.translateLocalization(localization.Text, targetLanguage, glossary)
-		time.Sleep(500 * time.Millisecond)
 		if err != nil {
-			// Too many requests
-			if strings.Contains(err.Error(), "429") {
-				logging.Errorf("Too many API requests in file (%s) waiting 10 seconds: %v", baseFile.FileName, err)
-				time.Sleep(10000 * time.Millisecond)
+			if isFatal(err) || ctx.Err() != nil {
+				// Keep what was translated so far and
+				// leave the remaining keys for the next run
+				runError = err
+				for _, remaining := range batches[batchIndex:] {
+					counterPending += len(remaining)
+				}
+				break
 			}
 
-			// Translation Error
-			logging.Warnf("Skipped localization key (%s) in file (%s) because of an error: %s", key, baseFile.FileName, err)
-			targetLocalization.Text = localization.Text
-			targetLocalization.CompareChecksum = skippedChecksum
-			file.Localizations[key] = targetLocalization
-			counterError++
-		} else {
-			targetLocalization.Text = response
-			targetLocalization.CompareChecksum = localization.Checksum
-			file.Localizations[key] = targetLocalization
-			counterTranslated++
+			// Translation Error after all retries
+			for _, entry := range batch {
+				logging.Warnf("Skipped localization key (%s) in file (%s) because of an error: %s", entry.Base.Key, baseFile.FileName, err)
+				entry.Target.Text = entry.Base.Text
+				entry.Target.CompareChecksum = skippedChecksum
+				entry.Target.Version = entry.Base.Version
+				file.Localizations[entry.Base.Key] = entry.Target
+				counterError++
+			}
+			continue
+		}
+		for i, entry := range batch {
+			entry.Target.Text = translations[i].Text
+			entry.Target.CompareChecksum = entry.Base.Checksum
+			entry.Target.Version = entry.Base.Version
+			entry.Target.Backend = translations[i].Backend
+			file.Localizations[entry.Base.Key] = entry.Target
+			if translations[i].Remembered {
+				counterMemory++
+			} else {
+				counterTranslated++
+			}
+		}
+
+		if checkpoint.reached(len(batch)) && batchIndex < len(batches)-1 {
+			err := file.WriteFile(baseFile, translator.BaseLanguage, targetLanguage, translator.keepOrphan(targetLanguage))
+			if err != nil {
+				return nil, fmt.Errorf("could not write checkpoint of target file (%s): %v", file.FileName, err)
+			}
+			translator.markPersisted(targetLanguage, baseFile, file)
+			if translator.Memory != nil {
+				err = translator.Memory.Save()
+				if err != nil {
+					return nil, fmt.Errorf("could not write checkpoint of translation memory: %v", err)
+				}
+			}
+			logging.Debugf(
+				"%s%s%s: Wrote checkpoint after %d localization keys",
+				logging.AnsiBoldOn, file.FileName, logging.AnsiAllDefault, counterTranslated,
+			)
 		}
 	}
 
+	translator.reportOrphans(baseFile, file, targetLanguage)
 	err := file.WriteFile(
 		baseFile,
 		translator.BaseLanguage,
 		targetLanguage,
+		translator.keepOrphan(targetLanguage),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("could not write target file (%s): %v", file.FileName, err)
 	}
+	translator.markPersisted(targetLanguage, baseFile, file)
 
+	if counterPending > 0 {
+		translator.addPending(targetLanguage, file.FileName, counterPending)
+		logging.Warnf(
+			"%s%s%s: Left %s%d%s localization keys for the next run",
+			logging.AnsiBoldOn, file.FileName, logging.AnsiAllDefault,
+			logging.AnsiBoldOn, counterPending, logging.AnsiAllDefault,
+		)
+	}
 	if counterError > 0 {
 		logging.Errorf(
 			"%s%s%s: Skipped %s%d%s localization keys because of an error",
@@ -209,6 +423,27 @@ func (translator *ParadoxTranslator) translateTargetFile(
 			logging.AnsiBoldOn, counterTranslated, logging.AnsiAllDefault,
 		)
 	}
+	if counterMemory > 0 {
+		logging.Infof(
+			"%s%s%s: Found %s%d%s localization keys in the translation memory",
+			logging.AnsiBoldOn, file.FileName, logging.AnsiAllDefault,
+			logging.AnsiBoldOn, counterMemory, logging.AnsiAllDefault,
+		)
+	}
+	if counterCarriedOver > 0 {
+		logging.Infof(
+			"%s%s%s: Carried over %s%d%s renamed or moved localization keys",
+			logging.AnsiBoldOn, file.FileName, logging.AnsiAllDefault,
+			logging.AnsiBoldOn, counterCarriedOver, logging.AnsiAllDefault,
+		)
+	}
+	if counterDrafts > 0 {
+		logging.Infof(
+			"%s%s%s: Wrote %s%d%s drafts from similar texts for review",
+			logging.AnsiBoldOn, file.FileName, logging.AnsiAllDefault,
+			logging.AnsiBoldOn, counterDrafts, logging.AnsiAllDefault,
+		)
+	}
 	if counterManual > 0 {
 		logging.Infof(
 			"%s%s%s: Found %s%d%s manually translated localization keys",
@@ -223,7 +458,7 @@ func (translator *ParadoxTranslator) translateTargetFile(
 			logging.AnsiBoldOn, counterUpToDate, logging.AnsiAllDefault,
 		)
 	}
-	if counterUpToDate == 0 && counterTranslated == 0 && counterManual == 0 {
+	if counterUpToDate == 0 && counterTranslated == 0 && counterManual == 0 && counterPending == 0 && counterMemory == 0 && counterDrafts == 0 && counterCarriedOver == 0 {
 		logging.Warnf(
 			"%s%s%s: Translated %sno%s localization keys",
 			logging.AnsiBoldOn, file.FileName, logging.AnsiAllDefault,
@@ -231,10 +466,100 @@ func (translator *ParadoxTranslator) translateTargetFile(
 		)
 	}
 
+	translator.filesLock.Lock()
 	targetLanguage.Files[baseFile.Key] = file
+	translator.filesLock.Unlock()
+	if runError != nil {
+		return nil, fmt.Errorf("stopped translation in file (%s): %w", file.FileName, runError)
+	}
 	return file, nil
 }
 
+// Returns the existing target file or creates a new one for the base file
+func (translator *ParadoxTranslator) targetFileFor(
+	baseFile,
+	targetFile *LocalizationFile,
+	targetLanguage *LocalizationLanguage,
+) *LocalizationFile {
+	if targetFile != nil {
+		return targetFile
+	}
+	baseTag := fmt.Sprintf("l_%s.yml", translator.BaseLanguage.Name)
+	targetTag := fmt.Sprintf("l_%s.yml", targetLanguage.Name)
+	name := strings.ReplaceAll(
+		baseFile.FileName,
+		baseTag,
+		targetTag,
+	)
+	path := filepath.Join(translator.LocalizationDirectory, targetLanguage.Name, name)
+	return &LocalizationFile{
+		Key:           baseFile.Key,
+		Path:          path,
+		FileName:      name,
+		Localizations: make(map[string]*Localization),
+	}
+}
+
+// Finds all localizations of the base file that are missing or outdated
+// in the target file and counts the manual and up to date ones.
+// Missing localizations come first, both sorted by key.
+func (translator *ParadoxTranslator) findPending(baseFile, file *LocalizationFile) (pending []*pendingLocalization, manual int, upToDate int) {
+	pending = make([]*pendingLocalization, 0)
+	for key, localization := range baseFile.Localizations {
+		targetLocalization, ok := file.Localizations[key]
+		if !ok {
+			targetLocalization = &Localization{
+				Key:             key,
+				CompareChecksum: skippedChecksum, // Mark as to be translated
+			}
+		}
+		if targetLocalization.CompareChecksum == 0 {
+			// Don't touch manual localizations
+			// in the target language
+			manual++
+			continue
+		}
+		if localization.Checksum == targetLocalization.CompareChecksum && !translator.versionChanged(localization, targetLocalization) {
+			// Localization was already translated
+			// and is up to date
+			upToDate++
+			continue
+		}
+		pending = append(pending, &pendingLocalization{
+			Base:    localization,
+			Target:  targetLocalization,
+			Request: escape(localization.Text),
+			Missing: !ok || targetLocalization.CompareChecksum == skippedChecksum,
+			// Only the version changed, so the same text
+			// has to be sent to the backend again
+			Retranslate: localization.Checksum == targetLocalization.CompareChecksum,
+		})
+	}
+	slices.SortFunc(pending, func(a, b *pendingLocalization) int {
+		if a.Missing != b.Missing {
+			if a.Missing {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Base.Key, b.Base.Key)
+	})
+	return pending, manual, upToDate
+}
+
+// Checks whether the version number of a localization in the base language
+// changed since it was translated. Target localizations without a version
+// number were written before versions were kept and never count as changed.
+func (translator *ParadoxTranslator) versionChanged(localization, targetLocalization *Localization) bool {
+	return translator.VersionChanges && targetLocalization.Version != "" && localization.Version != targetLocalization.Version
+}
+
+// Errors that will fail every following request as well
+// and therefore stop the whole translation run
+func isFatal(err error) bool {
+	return errors.Is(err, backend.ErrQuotaExceeded) || errors.Is(err, backend.ErrAuthorization)
+}
+
 func escape(content string) string {
 	// Escape functions
 	requestContent := strings.ReplaceAll(content, "[", ignoreTagStart+"[")
@@ -262,17 +587,124 @@ func normalize(content string) string {
 	return result
 }
 
-func (translator *ParadoxTranslator) translateLocalization(content string, targetLanguage *LocalizationLanguage, glossary string) (string, error) {
-	requestContent := escape(content)
-	response, err := translator.Api.Translate(
-		[]string{requestContent},
-		translator.BaseLanguage.Locale,
-		targetLanguage.Locale,
-		[]string{"ignore", "ref"},
-		glossary,
-	)
+// Translates a batch with the backend. Texts that are in the translation memory
+// by now are not sent unless they have to be retranslated,
+// and identical texts are only sent once.
+// With sentence segmentation only the sentences that are not
+// in the translation memory are sent.
+func (translator *ParadoxTranslator) translateBatch(
+	ctx context.Context,
+	batch []*pendingLocalization,
+	targetLanguage *LocalizationLanguage,
+	languageConfig *TranslationConfigurationLanguage,
+) ([]*translation, error) {
+	glossary := translator.requestGlossary(languageConfig)
+	translations := make([]*translation, len(batch))
+	segments := make([][]segment, len(batch))
+	results := make(map[string]*translation)
+	sources := make([]string, 0, len(batch))
+	for i, entry := range batch {
+		if remembered, ok := translator.lookupMemory(entry.Base.Text, targetLanguage, glossary); ok && !entry.Retranslate {
+			translations[i] = &translation{Text: remembered.Translation, Backend: remembered.Backend, Remembered: true}
+			continue
+		}
+		segments[i] = translator.segments(entry.Base.Text)
+		for _, part := range segments[i] {
+			if !part.Translate {
+				continue
+			}
+			if result, ok := results[part.Text]; ok && (result == nil || !result.Remembered || !entry.Retranslate) {
+				continue
+			}
+			if remembered, ok := translator.lookupMemory(part.Text, targetLanguage, glossary); ok && !entry.Retranslate {
+				results[part.Text] = &translation{Text: remembered.Translation, Backend: remembered.Backend, Remembered: true}
+				continue
+			}
+			results[part.Text] = nil
+			sources = append(sources, part.Text)
+		}
+	}
+
+	err := translator.translateSources(ctx, sources, results, targetLanguage, languageConfig, glossary)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return normalize(response.Translations[0].Translation), nil
+
+	for i, entry := range batch {
+		if translations[i] != nil {
+			continue
+		}
+		translations[i] = assembleSegments(segments[i], results, translator.Backend.Name())
+		translator.remember(entry.Base.Text, targetLanguage, glossary, translations[i])
+	}
+	return translations, nil
+}
+
+// Sends the texts to the backend in requests that respect its limits
+// and stores the translations in the results and the translation memory
+func (translator *ParadoxTranslator) translateSources(
+	ctx context.Context,
+	sources []string,
+	results map[string]*translation,
+	targetLanguage *LocalizationLanguage,
+	languageConfig *TranslationConfigurationLanguage,
+	glossary string,
+) error {
+	requests := make([]*pendingLocalization, len(sources))
+	for i, source := range sources {
+		requests[i] = &pendingLocalization{
+			Base:    &Localization{Text: source},
+			Request: escape(source),
+		}
+	}
+	capabilities := translator.Backend.Capabilities()
+	for _, batch := range createBatches(requests, capabilities.MaxTexts, capabilities.MaxRequestSize) {
+		requestContent := make([]string, len(batch))
+		for i, entry := range batch {
+			requestContent[i] = entry.Request
+		}
+		response, err := translator.Backend.Translate(ctx, &backend.Request{
+			Texts: requestContent,
+			SourceLanguage: backend.Language{
+				Name:   translator.BaseLanguage.Name,
+				Locale: translator.BaseLanguage.Locale,
+			},
+			TargetLanguage: backend.Language{
+				Name:   targetLanguage.Name,
+				Locale: targetLanguage.Locale,
+			},
+			IgnoreTags: []string{"ignore", "ref"},
+			Glossary:   glossary,
+			Terms:      languageConfig.Terms,
+		})
+		if err != nil {
+			return err
+		}
+		if len(response.Translations) != len(batch) {
+			return fmt.Errorf("expected %d translations but got %d", len(batch), len(response.Translations))
+		}
+		backendName := response.Backend
+		if backendName == "" {
+			backendName = translator.Backend.Name()
+		}
+		for i, entry := range batch {
+			result := &translation{
+				Text:    normalize(response.Translations[i]),
+				Backend: backendName,
+			}
+			results[entry.Base.Text] = result
+			translator.remember(entry.Base.Text, targetLanguage, glossary, result)
+		}
+	}
+	return nil
+}
+
+func (translator *ParadoxTranslator) addPending(targetLanguage *LocalizationLanguage, fileName string, keys int) {
+	translator.pendingLock.Lock()
+	defer translator.pendingLock.Unlock()
+	translator.Pending = append(translator.Pending, &PendingFile{
+		Language: targetLanguage.Name,
+		FileName: fileName,
+		Keys:     keys,
+	})
 }
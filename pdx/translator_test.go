@@ -0,0 +1,119 @@
+package pdx
+
+import (
+	"bahmut.de/pdx-deepl/backend"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Backend for tests that prefixes every text or fails with an error
+type fakeBackend struct {
+	err error
+}
+
+func (fake *fakeBackend) Name() string {
+	return "fake"
+}
+
+func (fake *fakeBackend) Capabilities() backend.Capabilities {
+	return backend.Capabilities{TagHandling: true, MaxTexts: 50, MaxRequestSize: 10000}
+}
+
+func (fake *fakeBackend) Translate(ctx context.Context, request *backend.Request) (*backend.Response, error) {
+	if fake.err != nil {
+		return nil, fake.err
+	}
+	translations := make([]string, len(request.Texts))
+	for i, text := range request.Texts {
+		translations[i] = "de:" + text
+	}
+	return &backend.Response{Backend: fake.Name(), Translations: translations}, nil
+}
+
+func (fake *fakeBackend) Usage(ctx context.Context) (*backend.Usage, error) {
+	return &backend.Usage{}, nil
+}
+
+// Writes the files of a localization directory, the paths are relative to it
+func writeTestDirectory(t *testing.T, files map[string]string) string {
+	directory := t.TempDir()
+	for path, content := range files {
+		path = filepath.Join(directory, path)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return directory
+}
+
+func translateTestDirectory(t *testing.T, directory string, translationBackend backend.Backend) error {
+	config := &TranslationConfiguration{
+		BaseLanguage:    "english",
+		TargetLanguages: []*TranslationConfigurationLanguage{{Name: "german"}},
+	}
+	translator, err := CreateTranslator(config, directory, translationBackend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return translator.Translate(context.Background())
+}
+
+func readTestFile(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestTranslateKeepsMovedKeysWhenStopped(t *testing.T) {
+	directory := writeTestDirectory(t, map[string]string{
+		"english/a_l_english.yml": "l_english:\n key_a: \"Hello\"\n",
+		"english/b_l_english.yml": "l_english:\n moved: \"Handmade\"\n",
+		"german/a_l_german.yml":   "l_german:\n moved: \"Handarbeit\"\n",
+	})
+	sourcePath := filepath.Join(directory, "german", "a_l_german.yml")
+	destinationPath := filepath.Join(directory, "german", "b_l_german.yml")
+
+	// The quota runs out in the first file and the
+	// file the key moved to is not written in this run
+	err := translateTestDirectory(t, directory, &fakeBackend{err: backend.ErrQuotaExceeded})
+	if !errors.Is(err, backend.ErrQuotaExceeded) {
+		t.Fatalf("got error %v, want %v", err, backend.ErrQuotaExceeded)
+	}
+	if content := readTestFile(t, sourcePath); !strings.Contains(content, "moved: \"Handarbeit\"") {
+		t.Fatalf("moved key was dropped before it was carried over:\n%s", content)
+	}
+	if content := readTestFile(t, destinationPath); content != "" {
+		t.Fatalf("stopped run wrote the file the key moved to:\n%s", content)
+	}
+
+	err = translateTestDirectory(t, directory, &fakeBackend{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := readTestFile(t, destinationPath); !strings.Contains(content, "moved: \"Handarbeit\"") {
+		t.Fatalf("moved key was not carried over:\n%s", content)
+	}
+
+	// Dropped once the file the key moved to has it
+	err = translateTestDirectory(t, directory, &fakeBackend{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := readTestFile(t, sourcePath); !strings.Contains(content, "key_a: \"de:Hello\"") || strings.Contains(content, "moved") {
+		t.Errorf("got\n%s\nwant the moved key to be removed", content)
+	}
+}
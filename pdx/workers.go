@@ -0,0 +1,102 @@
+package pdx
+
+import (
+	"bahmut.de/pdx-deepl/logging"
+	"context"
+	"slices"
+	"sync"
+)
+
+type translationJob struct {
+	BaseFile       *LocalizationFile
+	TargetLanguage *LocalizationLanguage
+	LanguageConfig *TranslationConfigurationLanguage
+	// MaxCharacters is the share of the character
+	// budget of the job (negative for no limit)
+	MaxCharacters int
+}
+
+// Translates all jobs with a pool of workers.
+// After the first error or when the context is done no further jobs
+// are started, jobs that are already running write what they translated.
+func (translator *ParadoxTranslator) runJobs(ctx context.Context, jobs []*translationJob) error {
+	remaining := make(map[*LocalizationLanguage]int)
+	for _, job := range jobs {
+		if remaining[job.TargetLanguage] == 0 {
+			logging.Infof("%sTranslating:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, job.TargetLanguage.Name)
+		}
+		remaining[job.TargetLanguage]++
+	}
+
+	var lock sync.Mutex
+	var runError error
+	skipped := false
+	queue := make(chan *translationJob)
+	var waitGroup sync.WaitGroup
+	for range max(translator.Workers, 1) {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for job := range queue {
+				lock.Lock()
+				stopped := runError != nil || ctx.Err() != nil
+				lock.Unlock()
+				if stopped {
+					translator.skipJob(job)
+					lock.Lock()
+					skipped = true
+					lock.Unlock()
+					continue
+				}
+
+				err := translator.translateJob(ctx, job)
+
+				lock.Lock()
+				if err != nil && runError == nil {
+					runError = err
+				}
+				remaining[job.TargetLanguage]--
+				if err == nil && remaining[job.TargetLanguage] == 0 {
+					logging.Infof("%sTranslated:%s %s", logging.AnsiBoldOn, logging.AnsiAllDefault, job.TargetLanguage.Name)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	waitGroup.Wait()
+
+	if runError == nil && skipped {
+		runError = ctx.Err()
+	}
+	return runError
+}
+
+func (translator *ParadoxTranslator) translateJob(ctx context.Context, job *translationJob) error {
+	translator.filesLock.Lock()
+	targetFile := job.TargetLanguage.Files[job.BaseFile.Key]
+	translator.filesLock.Unlock()
+
+	_, err := translator.translateTargetFile(ctx, job.BaseFile, targetFile, job.TargetLanguage, job.LanguageConfig, job.MaxCharacters)
+	return err
+}
+
+// Records the keys of a job that was not started as pending
+func (translator *ParadoxTranslator) skipJob(job *translationJob) {
+	if slices.Contains(translator.Config.IgnoreFiles, job.BaseFile.FileName) {
+		return
+	}
+	translator.filesLock.Lock()
+	targetFile := job.TargetLanguage.Files[job.BaseFile.Key]
+	translator.filesLock.Unlock()
+
+	file := translator.targetFileFor(job.BaseFile, targetFile, job.TargetLanguage)
+	pending, _, _ := translator.findPending(job.BaseFile, file)
+	if len(pending) > 0 {
+		translator.addPending(job.TargetLanguage, file.FileName, len(pending))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bahmut.de/pdx-deepl/backend"
+	"bahmut.de/pdx-deepl/logging"
+	"bahmut.de/pdx-deepl/pdx"
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	QuotaAbort   = "abort"
+	QuotaConfirm = "confirm"
+	QuotaFit     = "fit"
+)
+
+var QuotaPolicies = []string{QuotaAbort, QuotaConfirm, QuotaFit}
+
+// Decides what happens when the run needs more characters than the API has left.
+// Returns false when the run should not be started.
+func applyQuotaPolicy(policy string, plan *pdx.Plan, usage *backend.Usage, translator *pdx.ParadoxTranslator) (bool, error) {
+	needed := plan.Characters
+	if translator.CharacterBudget > 0 {
+		needed = min(needed, translator.CharacterBudget)
+	}
+	logging.Infof("%sCharacters Needed:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, needed)
+	if !usage.Limited() {
+		return true, nil
+	}
+	remaining := usage.Remaining()
+	logging.Infof("%sCharacters Remaining:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, remaining)
+	if needed <= remaining {
+		return true, nil
+	}
+
+	logging.Warnf(
+		"The run needs %s%d%s characters but only %s%d%s are left in the API quota",
+		logging.AnsiBoldOn, needed, logging.AnsiAllDefault,
+		logging.AnsiBoldOn, remaining, logging.AnsiAllDefault,
+	)
+	switch policy {
+	case QuotaAbort:
+		return false, nil
+	case QuotaConfirm:
+		if !confirm("Translate only as much as fits into the remaining quota?") {
+			return false, nil
+		}
+	case QuotaFit:
+	default:
+		return false, fmt.Errorf("unknown quota policy: %s", policy)
+	}
+	translator.CharacterBudget = remaining
+	return true, nil
+}
+
+// Asks a yes or no question on the console
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// Logs the characters used by the run according to the usage of the API
+func reportUsage(ctx context.Context, translationBackend backend.Backend, before *backend.Usage) {
+	if !before.Limited() {
+		return
+	}
+	// The run may have been cancelled, but the usage is still of interest
+	after, err := translationBackend.Usage(context.WithoutCancel(ctx))
+	if err != nil {
+		logging.Warnf("Could not get the %sAPI Character Usage%s after the run: %s", logging.AnsiBoldOn, logging.AnsiAllDefault, err)
+		return
+	}
+	logging.Infof("%sAPI Characters Used:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, after.CharacterCount-before.CharacterCount)
+	logging.Infof("%sAPI Characters Remaining:%s %d", logging.AnsiBoldOn, logging.AnsiAllDefault, after.Remaining())
+}